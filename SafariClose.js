@@ -77,6 +77,11 @@ function run(argv) {
     $.exit(0);
   }
 
+  if (!app.running()) {
+    console.log('Safari is not running');
+    $.exit(1);
+  }
+
   // Validate arguments
   if (!whats.contains(what)) {
     console.log('Invalid target: ' + what);
@@ -18,16 +18,31 @@ var safari = Application('Safari')
 safari.includeStandardAdditions = true
 
 
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
 function getCurrentTab() {
   var winIdx = 1,
-    tab = safari.windows[0].currentTab,
+    win = safari.windows[0],
+    tab = win.currentTab,
     tabIdx = tab.index(),
     title = tab.name(),
     url = tab.url()
   console.log('win=1, tab=' + tabIdx + ', title="' + title + '", url=' + url)
-  return {title: title, url: url, index: tabIdx, windowIndex: 1}
+  return {id: tabID(tab), title: title, url: url, index: tabIdx, windowIndex: 1, windowID: win.id(), active: true}
 }
 
 function run(argv) {
+  if (!Application('Safari').running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
   return JSON.stringify(getCurrentTab())
 }
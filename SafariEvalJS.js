@@ -0,0 +1,92 @@
+#!/usr/bin/env osascript -l JavaScript
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-04
+//
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// wrap <js> | Wrap expression js in a function that returns its value or
+// the exception it throws as JSON
+function wrap(js) {
+  return '(function() {\n' +
+    '  try {\n' +
+    '    var value = (\n' + js + '\n)\n' +
+    '    return JSON.stringify({value: value === undefined ? null : value})\n' +
+    '  }\n' +
+    '  catch (e) {\n' +
+    '    return JSON.stringify({error: {name: String(e && e.name || "Error"), message: String(e && e.message || e)}})\n' +
+    '  }\n' +
+    '})()'
+}
+
+// evalJSInTab <win> <tab> <js> | Evaluate JavaScript in tab
+function evalJSInTab(winIdx, tabIdx, js) {
+
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  try {
+    var tab = win.tabs[tabIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+
+  try {
+    var out = safari.doJavaScript(wrap(js), {in: tab})
+  }
+  catch (e) {
+    // Probably "Allow JavaScript from Apple Events" is off
+    console.log(e.message)
+    $.exit(1)
+  }
+
+  // Script didn't run, so the wrapper didn't return a string
+  if (typeof(out) !== 'string') {
+    return JSON.stringify({error: {name: 'SyntaxError', message: 'script did not run'}})
+  }
+  return out
+}
+
+function run(argv) {
+  var winIdx = 0,
+      tabIdx = 0;
+
+  if (argv.length != 3) {
+    console.log('Usage: SafariEvalJS.js <win> <tab> <expression>')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  winIdx = parseInt(argv[0], 10)
+  tabIdx = parseInt(argv[1], 10)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[0])
+    $.exit(1)
+  }
+  if (isNaN(tabIdx)) {
+    console.log('Invalid tab: ' + argv[1])
+    $.exit(1)
+  }
+
+  return evalJSInTab(winIdx, tabIdx, argv[2])
+}
@@ -0,0 +1,115 @@
+#!/usr/bin/env osascript -l JavaScript
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-07
+//
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
+// getWindow | Return window winIdx
+function getWindow(winIdx) {
+  try {
+    return safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+}
+
+// windowIndex | Return the current index of window win
+function windowIndex(win) {
+  var id = win.id(),
+    ids = safari.windows.id()
+
+  for (var i = 0; i < ids.length; i++) {
+    if (ids[i] === id) {
+      return i+1
+    }
+  }
+  return 0
+}
+
+// moveTab | Move tab tabIdx of window winIdx and return the tab's data
+function moveTab(winIdx, tabIdx, toWinIdx, toTabIdx) {
+  var win = getWindow(winIdx)
+
+  if (tabIdx < 1 || tabIdx > win.tabs.length) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+  var tab = win.tabs[tabIdx-1],
+    newWin = toWinIdx === 0
+
+  if (newWin) {
+    safari.Document().make()
+    var toWin = safari.windows[0](),
+      blank = toWin.tabs[0]()
+    safari.move(tab, {to: toWin.tabs.end})
+    blank.close()
+    toWinIdx = 1
+    toTabIdx = 1
+  } else {
+    var toWin = getWindow(toWinIdx),
+      n = toWin.tabs.length,
+      same = toWinIdx === winIdx
+
+    if (toTabIdx < 1 || toTabIdx > n || (same && toTabIdx === n)) {
+      safari.move(tab, {to: toWin.tabs.end})
+      toTabIdx = toWin.tabs.length
+    } else if (same && toTabIdx > tabIdx) {
+      safari.move(tab, {to: toWin.tabs[toTabIdx-1].after})
+    } else if (!same || toTabIdx < tabIdx) {
+      safari.move(tab, {to: toWin.tabs[toTabIdx-1].before})
+    }
+  }
+
+  // Safari closes a window when its last tab is moved out, which changes
+  // the indices of the windows behind it
+  toWinIdx = windowIndex(toWin)
+
+  var moved = toWin.tabs[toTabIdx-1]
+  return {id: tabID(moved), title: moved.name(), url: moved.url(), index: toTabIdx,
+    windowIndex: toWinIdx, windowID: toWin.id(), active: toWin.currentTab.index() === toTabIdx}
+}
+
+function run(argv) {
+  if (argv.length != 4) {
+    console.log('Usage: SafariMove.js <win> <tab> <to-win> <to-tab>')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  var args = argv.map(function(s) { return parseInt(s, 10) })
+  if (isNaN(args[0]) || isNaN(args[2])) {
+    console.log('Invalid window: ' + argv[0] + ', ' + argv[2])
+    $.exit(1)
+  }
+  if (isNaN(args[1]) || isNaN(args[3])) {
+    console.log('Invalid tab: ' + argv[1] + ', ' + argv[3])
+    $.exit(1)
+  }
+
+  return JSON.stringify(moveTab(args[0], args[1], args[2], args[3]))
+}
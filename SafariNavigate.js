@@ -0,0 +1,92 @@
+#!/usr/bin/env osascript -l JavaScript
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-06
+//
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+// Actions that need "Allow JavaScript from Apple Events"
+var scripts = {
+  // Setting a tab's URL to itself doesn't reload the page if the URL has
+  // a #fragment, and fails if the tab has no URL
+  'reload': 'location.reload()',
+  'back': 'history.back()',
+  'forward': 'history.forward()',
+  'stop': 'window.stop()',
+}
+
+
+// navigate <action> <win> <tab> <url> | Perform action in tab
+function navigate(action, winIdx, tabIdx, url) {
+
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  try {
+    var tab = win.tabs[tabIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+
+  if (action === 'go') {
+    tab.url = url
+    return
+  }
+
+  try {
+    safari.doJavaScript(scripts[action], {in: tab})
+  }
+  catch (e) {
+    console.log(e.message)
+    $.exit(1)
+  }
+}
+
+function run(argv) {
+  var action = argv[0],
+    winIdx = 0,
+    tabIdx = 0;
+
+  if (argv.length < 3 || (action === 'go' && argv.length != 4)) {
+    console.log('Usage: SafariNavigate.js (go|reload|back|forward|stop) <win> <tab> [<url>]')
+    $.exit(1)
+  }
+
+  if (action !== 'go' && !scripts.hasOwnProperty(action)) {
+    console.log('Invalid action: ' + action)
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  winIdx = parseInt(argv[1], 10)
+  tabIdx = parseInt(argv[2], 10)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[1])
+    $.exit(1)
+  }
+  if (isNaN(tabIdx)) {
+    console.log('Invalid tab: ' + argv[2])
+    $.exit(1)
+  }
+
+  navigate(action, winIdx, tabIdx, argv[3])
+}
@@ -0,0 +1,115 @@
+#!/usr/bin/env osascript -l JavaScript
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-05
+//
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
+// tabInfo | Return data for tab tabIdx of window win, which is at winIdx
+function tabInfo(win, winIdx, tab, tabIdx) {
+  return {id: tabID(tab), title: tab.name(), url: tab.url(), index: tabIdx,
+    windowIndex: winIdx, windowID: win.id(), active: win.currentTab.index() === tabIdx}
+}
+
+// openTab | Open url in a new tab in window winIdx
+function openTab(url, winIdx, background) {
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  win.tabs.push(safari.Tab({url: url}))
+  var tabIdx = win.tabs.length,
+    tab = win.tabs[tabIdx-1]()
+
+  if (!background) {
+    win.currentTab = tab
+    if (winIdx != 1) {
+      win.visible = false
+      win.visible = true
+    }
+    safari.activate()
+    winIdx = 1
+  }
+  return tabInfo(win, winIdx, tab, tabIdx)
+}
+
+// openWindow | Open url in a new window
+function openWindow(url, background) {
+  safari.Document().make()
+  var win = safari.windows[0]()
+  win.currentTab.url = url
+  if (!background) {
+    safari.activate()
+  }
+  return tabInfo(win, 1, win.currentTab(), 1)
+}
+
+// openPrivate | Open url in a new private window. Safari can't script
+// private windows, so this presses ⌘⇧N via System Events.
+function openPrivate(url) {
+  var n = safari.windows.length
+  safari.activate()
+  Application('System Events').keystroke('n', {using: ['command down', 'shift down']})
+
+  for (var i = 0; i < 50 && safari.windows.length === n; i++) {
+    delay(0.1)
+  }
+  if (safari.windows.length === n) {
+    console.log('Private window did not open')
+    $.exit(1)
+  }
+
+  var win = safari.windows[0]()
+  win.currentTab.url = url
+  return tabInfo(win, 1, win.currentTab(), 1)
+}
+
+function run(argv) {
+  if (argv.length < 2) {
+    console.log('Usage: SafariOpen.js <url> <win> [new-window|private|background...]')
+    $.exit(1)
+  }
+
+  var url = argv[0],
+    winIdx = parseInt(argv[1], 10),
+    flags = argv.slice(2)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[1])
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    safari.launch()
+  }
+
+  if (flags.indexOf('private') > -1) {
+    return JSON.stringify(openPrivate(url))
+  }
+  if (flags.indexOf('new-window') > -1 || safari.windows.length === 0) {
+    return JSON.stringify(openWindow(url, flags.indexOf('background') > -1))
+  }
+  return JSON.stringify(openTab(url, winIdx, flags.indexOf('background') > -1))
+}
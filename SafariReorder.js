@@ -0,0 +1,73 @@
+#!/usr/bin/env osascript -l JavaScript
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-07
+//
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// reorder | Put the tabs of window winIdx in order
+function reorder(winIdx, order) {
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  var n = win.tabs.length,
+    current = []
+
+  if (order.length != n) {
+    console.log('Invalid tab order for window ' + winIdx + ': ' + order.length + ' tabs, expected ' + n)
+    $.exit(1)
+  }
+
+  // current holds the original indices of the tabs in their current order
+  for (var i = 1; i <= n; i++) {
+    current.push(i)
+  }
+
+  for (var i = 1; i <= n; i++) {
+    var pos = current.indexOf(order[i-1]) + 1
+    if (pos === 0) {
+      console.log('Invalid tab for window ' + winIdx + ': ' + order[i-1])
+      $.exit(1)
+    }
+    if (pos === i) continue
+
+    // pos > i, as tabs before i are in their final positions
+    safari.move(win.tabs[pos-1], {to: win.tabs[i-1].before})
+    current.splice(i-1, 0, current.splice(pos-1, 1)[0])
+  }
+}
+
+function run(argv) {
+  if (argv.length < 1) {
+    console.log('Usage: SafariReorder.js <win> <tab>...')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  var winIdx = parseInt(argv[0], 10),
+    order = argv.slice(1).map(function(s) { return parseInt(s, 10) })
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[0])
+    $.exit(1)
+  }
+
+  reorder(winIdx, order)
+}
@@ -44,6 +44,11 @@ function run(argv) {
     $.exit(1)
   }
 
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
   winIdx = parseInt(argv[0], 10)
   tabIdx = parseInt(argv[1], 10)
   js = argv[2]
@@ -15,6 +15,16 @@
 ObjC.import('stdlib')
 ObjC.import('stdio')
 
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
 function getWindows() {
 
   var safari = Application('Safari')
@@ -24,8 +34,8 @@ function getWindows() {
   var wins = safari.windows
 
   for (i=0; i<wins.length; i++) {
-    var data = {'index': i+1, 'tabs': []},
-      w = wins[i],
+    var w = wins[i],
+      data = {'index': i+1, 'id': w.id(), 'tabs': []},
       tabs = w.tabs
 
     // Ignore non-browser windows
@@ -41,10 +51,12 @@ function getWindows() {
     for (j=0; j<tabs.length; j++) {
       var t = tabs[j]
       data.tabs.push({
+        'id': tabID(t),
         'title': t.name(),
         'url': t.url(),
         'index': j+1,
         'windowIndex': i+1,
+        'windowID': data['id'],
 	'active': j+1 === data['activeTab']
       })
     }
@@ -55,5 +67,9 @@ function getWindows() {
 }
 
 function run(argv) {
+  if (!Application('Safari').running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
   return JSON.stringify(getWindows())
 }
\ No newline at end of file
@@ -0,0 +1,296 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-20
+//
+
+package safari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// CloseTarget specifies what Backend.Close closes.
+type CloseTarget string
+
+// Valid CloseTargets.
+const (
+	TargetWin       CloseTarget = "win"        // The whole window
+	TargetTab       CloseTarget = "tab"        // The specified tab
+	TargetTabsOther CloseTarget = "tabs-other" // All tabs except the specified one
+	TargetTabsLeft  CloseTarget = "tabs-left"  // Tabs to the left of the specified one
+	TargetTabsRight CloseTarget = "tabs-right" // Tabs to the right of the specified one
+)
+
+// NavAction specifies what Backend.Navigate does.
+type NavAction string
+
+// Valid NavActions.
+const (
+	NavGo      NavAction = "go"      // Load a URL
+	NavReload  NavAction = "reload"  // Reload the page
+	NavBack    NavAction = "back"    // Go back in history
+	NavForward NavAction = "forward" // Go forward in history
+	NavStop    NavAction = "stop"    // Stop loading the page
+)
+
+// Backend talks to Safari. The package-level tab and window functions, and
+// the methods of Tab, call the current Backend, which is set with
+// SetBackend.
+//
+// Windows and tabs are addressed by 1-based index, with window 1 being the
+// frontmost window. Activating a window brings it to the front, so it
+// changes the indices of other windows.
+//
+// Each method should return ctx.Err() if ctx is cancelled before the
+// operation completes.
+type Backend interface {
+	// Windows returns Safari's browser windows, frontmost first.
+	Windows(ctx context.Context) ([]*Window, error)
+	// ActiveTab returns the current tab of the frontmost window.
+	ActiveTab(ctx context.Context) (*Tab, error)
+	// Activate brings window win to the front and makes tab the current
+	// tab. If tab is 0, the current tab is not changed.
+	Activate(ctx context.Context, win, tab int) error
+	// Close closes the target relative to the given window and tab. If tab
+	// is 0, the window's current tab is used.
+	Close(ctx context.Context, what CloseTarget, win, tab int) error
+	// RunJS executes JavaScript in the specified tab.
+	RunJS(ctx context.Context, win, tab int, js string) error
+	// EvalJS evaluates JavaScript expression js in the specified tab and
+	// returns its value as JSON. If js throws an exception, EvalJS
+	// returns a *JSError.
+	EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error)
+	// Open opens URL in a new tab or window, as specified by opts, and
+	// returns the new tab. opts.Window is never 0.
+	Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error)
+	// Navigate performs action in the specified tab. URL is the URL to
+	// load for NavGo, and is ignored otherwise.
+	Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error
+	// Move moves the specified tab to position toTab in window toWin,
+	// and returns the moved tab. If toWin is 0, the tab is moved to a new
+	// window. If toTab is 0, the tab is moved to the end of the window.
+	Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error)
+	// Reorder reorders the tabs in window win. order lists the current
+	// indices of all the window's tabs in their new order.
+	Reorder(ctx context.Context, win int, order []int) error
+}
+
+// backend is the Backend used by the package-level functions.
+var backend Backend = OSAScript{}
+
+// SetBackend sets the Backend used by the package-level tab and window
+// functions. It is not safe to call SetBackend while other goroutines
+// are using the package.
+func SetBackend(b Backend) { backend = b }
+
+// uncached returns the Backend b caches results from, or b if it doesn't
+// cache results.
+func uncached(b Backend) Backend {
+	if u, ok := b.(interface{ Uncached() Backend }); ok {
+		return u.Uncached()
+	}
+	return b
+}
+
+// CurrentBackend returns the Backend used by the package-level tab and
+// window functions.
+func CurrentBackend() Backend { return backend }
+
+// OSAScript is the default Backend. It drives Safari via JavaScript for
+// Automation scripts run with /usr/bin/osascript, so it only works on a Mac.
+// The osascript process is killed if the Context is cancelled.
+//
+// Each call starts a new osascript process. Use a Worker to avoid that cost.
+type OSAScript struct{}
+
+// Windows implements Backend.
+func (OSAScript) Windows(ctx context.Context) ([]*Window, error) {
+	return jxaRunner(runJXA).Windows(ctx)
+}
+
+// ActiveTab implements Backend.
+func (OSAScript) ActiveTab(ctx context.Context) (*Tab, error) {
+	return jxaRunner(runJXA).ActiveTab(ctx)
+}
+
+// Activate implements Backend.
+func (OSAScript) Activate(ctx context.Context, win, tab int) error {
+	return jxaRunner(runJXA).Activate(ctx, win, tab)
+}
+
+// Close implements Backend.
+func (OSAScript) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	return jxaRunner(runJXA).Close(ctx, what, win, tab)
+}
+
+// RunJS implements Backend.
+func (OSAScript) RunJS(ctx context.Context, win, tab int, js string) error {
+	return jxaRunner(runJXA).RunJS(ctx, win, tab, js)
+}
+
+// EvalJS implements Backend.
+func (OSAScript) EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error) {
+	return jxaRunner(runJXA).EvalJS(ctx, win, tab, js)
+}
+
+// Open implements Backend.
+func (OSAScript) Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error) {
+	return jxaRunner(runJXA).Open(ctx, URL, opts)
+}
+
+// Navigate implements Backend. NavReload, NavBack, NavForward and NavStop
+// require Safari's "Allow JavaScript from Apple Events" setting.
+func (OSAScript) Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error {
+	return jxaRunner(runJXA).Navigate(ctx, action, win, tab, URL)
+}
+
+// Move implements Backend.
+func (OSAScript) Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error) {
+	return jxaRunner(runJXA).Move(ctx, win, tab, toWin, toTab)
+}
+
+// Reorder implements Backend.
+func (OSAScript) Reorder(ctx context.Context, win int, order []int) error {
+	return jxaRunner(runJXA).Reorder(ctx, win, order)
+}
+
+// jxaRunner runs one of the JXA scripts in js.go with arguments argv and
+// returns the script's output. It implements Backend with the scripts, so
+// OSAScript and Worker only differ in how they run them.
+type jxaRunner func(ctx context.Context, script string, argv ...string) ([]byte, error)
+
+// Windows implements Backend.
+func (run jxaRunner) Windows(ctx context.Context) ([]*Window, error) {
+	wins := []*Window{}
+
+	if err := run.json(ctx, jsGetTabs, &wins); err != nil {
+		return nil, err
+	}
+	return wins, nil
+}
+
+// ActiveTab implements Backend.
+func (run jxaRunner) ActiveTab(ctx context.Context) (*Tab, error) {
+	tab := &Tab{}
+
+	if err := run.json(ctx, jsGetCurrentTab, &tab); err != nil {
+		return nil, err
+	}
+	return tab, nil
+}
+
+// Activate implements Backend.
+func (run jxaRunner) Activate(ctx context.Context, win, tab int) error {
+	args := []string{fmt.Sprintf("%d", win)}
+	if tab > 0 {
+		args = append(args, fmt.Sprintf("%d", tab))
+	}
+
+	_, err := run(ctx, jsActivate, args...)
+	return err
+}
+
+// Close implements Backend.
+func (run jxaRunner) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	args := []string{string(what), fmt.Sprintf("%d", win)}
+	if tab > 0 {
+		args = append(args, fmt.Sprintf("%d", tab))
+	}
+
+	_, err := run(ctx, jsClose, args...)
+	return err
+}
+
+// RunJS implements Backend.
+func (run jxaRunner) RunJS(ctx context.Context, win, tab int, js string) error {
+	_, err := run(ctx, jsRunJavaScript, fmt.Sprintf("%d", win), fmt.Sprintf("%d", tab), js)
+	return err
+}
+
+// EvalJS implements Backend.
+func (run jxaRunner) EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error) {
+	res := struct {
+		Value json.RawMessage `json:"value"`
+		Error *JSError        `json:"error"`
+	}{}
+
+	if err := run.json(ctx, jsEvalJavaScript, &res, fmt.Sprintf("%d", win), fmt.Sprintf("%d", tab), js); err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return res.Value, nil
+}
+
+// Open implements Backend.
+func (run jxaRunner) Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error) {
+	args := []string{URL, fmt.Sprintf("%d", opts.Window)}
+	if opts.NewWindow {
+		args = append(args, "new-window")
+	}
+	if opts.Private {
+		args = append(args, "private")
+	}
+	if opts.Background {
+		args = append(args, "background")
+	}
+
+	tab := &Tab{}
+	if err := run.json(ctx, jsOpen, tab, args...); err != nil {
+		return nil, err
+	}
+	return tab, nil
+}
+
+// Navigate implements Backend.
+func (run jxaRunner) Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error {
+	args := []string{string(action), fmt.Sprintf("%d", win), fmt.Sprintf("%d", tab)}
+	if action == NavGo {
+		args = append(args, URL)
+	}
+
+	_, err := run(ctx, jsNavigate, args...)
+	return err
+}
+
+// Move implements Backend.
+func (run jxaRunner) Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error) {
+	args := []string{
+		fmt.Sprintf("%d", win), fmt.Sprintf("%d", tab),
+		fmt.Sprintf("%d", toWin), fmt.Sprintf("%d", toTab),
+	}
+
+	t := &Tab{}
+	if err := run.json(ctx, jsMove, t, args...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reorder implements Backend.
+func (run jxaRunner) Reorder(ctx context.Context, win int, order []int) error {
+	args := []string{fmt.Sprintf("%d", win)}
+	for _, i := range order {
+		args = append(args, fmt.Sprintf("%d", i))
+	}
+
+	_, err := run(ctx, jsReorder, args...)
+	return err
+}
+
+// json runs a script and unmarshals its output to target using
+// json.Unmarshal()
+func (run jxaRunner) json(ctx context.Context, script string, target interface{}, argv ...string) error {
+	data, err := run(ctx, script, argv...)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
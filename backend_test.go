@@ -0,0 +1,64 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-04
+//
+
+package safari
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubRunner returns a jxaRunner that outputs out and records its arguments.
+func stubRunner(out string, err error, args *[]string) jxaRunner {
+	return func(ctx context.Context, script string, argv ...string) ([]byte, error) {
+		*args = argv
+		return []byte(out), err
+	}
+}
+
+func TestJXAEvalJS(t *testing.T) {
+	jsErr := &JSError{"TypeError", "x is undefined"}
+	tests := []struct {
+		name   string
+		out    string
+		runErr error // returned by script
+		x      string
+		err    error
+	}{
+		{"value", `{"value": {"n": 1}}` + "\n", nil, `{"n": 1}`, nil},
+		{"null", `{"value": null}`, nil, "null", nil},
+		{"exception", `{"error": {"name": "TypeError", "message": "x is undefined"}}`, nil, "", jsErr},
+		{"disabled", "", ErrJSDisabled, "", ErrJSDisabled},
+	}
+
+	for _, td := range tests {
+		var args []string
+		data, err := stubRunner(td.out, td.runErr, &args).EvalJS(context.Background(), 2, 3, "document.title")
+		if td.err != nil {
+			var e *JSError
+			if errors.As(err, &e) {
+				err = errors.New(e.Error())
+			}
+			if err == nil || err.Error() != td.err.Error() {
+				t.Errorf("%s: Expected=%v, Got=%v", td.name, td.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			continue
+		}
+		if string(data) != td.x {
+			t.Errorf("%s: bad value. Expected=%s, Got=%s", td.name, td.x, data)
+		}
+		if len(args) != 3 || args[0] != "2" || args[1] != "3" || args[2] != "document.title" {
+			t.Errorf("%s: bad arguments: %q", td.name, args)
+		}
+	}
+}
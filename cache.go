@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-03
+//
+
+package safari
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/deanishe/go-safari/internal/errs"
+)
+
+// now returns the time cached data are compared against.
+var now = time.Now
+
+// Names of CachedBackend's cache files.
+const (
+	windowsCacheFile   = "windows.json"
+	activeTabCacheFile = "active-tab.json"
+)
+
+// CachedBackend is a Backend that caches the results of another Backend's
+// Windows and ActiveTab methods for TTL. The cache is cleared whenever a
+// tab or window is opened, activated, navigated, moved or closed, or
+// JavaScript is run in a tab, via the CachedBackend.
+//
+// If Dir is set, results are also cached in that directory, so short-lived
+// programs, such as Alfred workflows, can share them. Each program should
+// use a CachedBackend, as changes made via other Backends don't clear the
+// cache. Nor, of course, do changes made by the user in Safari, so keep TTL
+// short. Tab's methods don't use the cache to find the tab.
+//
+// A CachedBackend is safe for concurrent use if its Backend is.
+type CachedBackend struct {
+	Backend Backend       // Backend whose results are cached
+	TTL     time.Duration // How long results are valid for
+	Dir     string        // Directory for on-disk cache; empty means memory only
+
+	mu       sync.Mutex
+	wins     []*Window
+	winsTime time.Time
+	tab      *Tab
+	tabTime  time.Time
+
+	invalidated time.Time // when Invalidate was last called
+}
+
+// NewCachedBackend creates a CachedBackend that caches the results of b
+// for ttl, in memory and, if dir isn't empty, in directory dir.
+func NewCachedBackend(b Backend, ttl time.Duration, dir string) *CachedBackend {
+	return &CachedBackend{Backend: b, TTL: ttl, Dir: dir}
+}
+
+// Uncached returns the Backend whose results are cached. Tab's methods use
+// it to find the tab's current position.
+func (c *CachedBackend) Uncached() Backend { return c.Backend }
+
+// Windows implements Backend.
+func (c *CachedBackend) Windows(ctx context.Context) ([]*Window, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.wins == nil || !c.fresh(c.winsTime) {
+		var wins []*Window
+		c.wins, c.winsTime = nil, time.Time{}
+		if t, ok := c.load(windowsCacheFile, &wins); ok {
+			c.wins, c.winsTime = wins, t
+		}
+	}
+	if c.wins != nil {
+		return copyWindows(c.wins), nil
+	}
+
+	wins, err := c.Backend.Windows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.wins, c.winsTime = copyWindows(wins), now()
+	c.save(windowsCacheFile, c.wins, c.winsTime)
+	return wins, nil
+}
+
+// ActiveTab implements Backend. If the windows are cached, the active tab
+// is taken from them.
+func (c *CachedBackend) ActiveTab(ctx context.Context) (*Tab, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tab == nil || !c.fresh(c.tabTime) {
+		var tab *Tab
+		c.tab, c.tabTime = nil, time.Time{}
+		if t, ok := c.load(activeTabCacheFile, &tab); ok {
+			c.tab, c.tabTime = tab, t
+		}
+	}
+	if c.tab == nil && len(c.wins) > 0 && c.fresh(c.winsTime) {
+		if w := c.wins[0]; w.Index == 1 && w.ActiveTab > 0 && w.ActiveTab <= len(w.Tabs) {
+			c.tab, c.tabTime = w.Tabs[w.ActiveTab-1], c.winsTime
+		}
+	}
+	if c.tab != nil {
+		t := *c.tab
+		return &t, nil
+	}
+
+	tab, err := c.Backend.ActiveTab(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := *tab
+	c.tab, c.tabTime = &t, now()
+	c.save(activeTabCacheFile, c.tab, c.tabTime)
+	return tab, nil
+}
+
+// Activate implements Backend.
+func (c *CachedBackend) Activate(ctx context.Context, win, tab int) error {
+	err := c.Backend.Activate(ctx, win, tab)
+	c.invalidate()
+	return err
+}
+
+// Close implements Backend.
+func (c *CachedBackend) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	err := c.Backend.Close(ctx, what, win, tab)
+	c.invalidate()
+	return err
+}
+
+// RunJS implements Backend. The cache is cleared, as the script may change
+// the tab's title or URL. So does EvalJS.
+func (c *CachedBackend) RunJS(ctx context.Context, win, tab int, js string) error {
+	err := c.Backend.RunJS(ctx, win, tab, js)
+	c.invalidate()
+	return err
+}
+
+// Open implements Backend.
+func (c *CachedBackend) Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error) {
+	tab, err := c.Backend.Open(ctx, URL, opts)
+	c.invalidate()
+	return tab, err
+}
+
+// Navigate implements Backend.
+func (c *CachedBackend) Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error {
+	err := c.Backend.Navigate(ctx, action, win, tab, URL)
+	c.invalidate()
+	return err
+}
+
+// Move implements Backend.
+func (c *CachedBackend) Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error) {
+	t, err := c.Backend.Move(ctx, win, tab, toWin, toTab)
+	c.invalidate()
+	return t, err
+}
+
+// Reorder implements Backend.
+func (c *CachedBackend) Reorder(ctx context.Context, win int, order []int) error {
+	err := c.Backend.Reorder(ctx, win, order)
+	c.invalidate()
+	return err
+}
+
+// EvalJS implements Backend.
+func (c *CachedBackend) EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error) {
+	data, err := c.Backend.EvalJS(ctx, win, tab, js)
+	c.invalidate()
+	return data, err
+}
+
+// Invalidate clears the in-memory and on-disk caches. Files older than the
+// in-memory cache are ignored, so even if deleting them fails, this
+// CachedBackend won't use them again. Other programs may, however.
+func (c *CachedBackend) Invalidate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wins, c.winsTime = nil, time.Time{}
+	c.tab, c.tabTime = nil, time.Time{}
+	c.invalidated = now()
+	if c.Dir == "" {
+		return nil
+	}
+	for _, name := range []string{windowsCacheFile, activeTabCacheFile} {
+		if err := os.Remove(filepath.Join(c.Dir, name)); err != nil && !os.IsNotExist(err) {
+			return errs.File(err)
+		}
+	}
+	return nil
+}
+
+// invalidate clears the caches after Safari has been changed. It doesn't
+// return an error, so callers don't retry a change that succeeded.
+func (c *CachedBackend) invalidate() { c.Invalidate() }
+
+// fresh returns true if data cached at t haven't expired.
+func (c *CachedBackend) fresh(t time.Time) bool {
+	age := now().Sub(t)
+	return age >= 0 && age < c.TTL
+}
+
+// cacheFile is the format of the on-disk cache files.
+type cacheFile struct {
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// load reads cache file name into v and returns the time it was cached.
+// It returns false if the file is missing, unreadable, expired or older
+// than the last call to Invalidate.
+func (c *CachedBackend) load(name string, v interface{}) (time.Time, bool) {
+	if c.Dir == "" {
+		return time.Time{}, false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(c.Dir, name))
+	if err != nil {
+		return time.Time{}, false
+	}
+	cf := cacheFile{}
+	if err := json.Unmarshal(data, &cf); err != nil || !c.fresh(cf.Time) || cf.Time.Before(c.invalidated) {
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(cf.Data, v); err != nil {
+		return time.Time{}, false
+	}
+	return cf.Time, true
+}
+
+// save writes v to cache file name. Errors are ignored, as the results
+// are still cached in memory.
+func (c *CachedBackend) save(name string, v interface{}, t time.Time) {
+	if c.Dir == "" {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if data, err = json.Marshal(cacheFile{t, data}); err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return
+	}
+	writeFileAtomic(filepath.Join(c.Dir, name), data)
+}
+
+// copyWindows returns a deep copy of wins, so callers can't modify the cache.
+func copyWindows(wins []*Window) []*Window {
+	c := make([]*Window, len(wins))
+	for i, w := range wins {
+		cw := *w
+		cw.Tabs = make([]*Tab, len(w.Tabs))
+		for j, t := range w.Tabs {
+			ct := *t
+			cw.Tabs[j] = &ct
+		}
+		c[i] = &cw
+	}
+	return c
+}
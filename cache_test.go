@@ -0,0 +1,237 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-03
+//
+
+package safari
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingBackend counts calls to Windows and ActiveTab.
+type countingBackend struct {
+	Backend
+	windows, activeTab int
+}
+
+func (cb *countingBackend) Windows(ctx context.Context) ([]*Window, error) {
+	cb.windows++
+	return cb.Backend.Windows(ctx)
+}
+
+func (cb *countingBackend) ActiveTab(ctx context.Context) (*Tab, error) {
+	cb.activeTab++
+	return cb.Backend.ActiveTab(ctx)
+}
+
+// setNow sets the time seen by the cache. Call the returned function to
+// restore the real clock.
+func setNow(t time.Time) func() {
+	prev := now
+	now = func() time.Time { return t }
+	return func() { now = prev }
+}
+
+func TestCachedBackend(t *testing.T) {
+	fb, cleanup := newTestBackend()
+	defer cleanup()
+
+	var (
+		start = time.Now()
+		cb    = &countingBackend{Backend: fb}
+		c     = NewCachedBackend(cb, 5*time.Second, "")
+	)
+	SetBackend(c)
+	defer setNow(start)()
+	fb.JS = func(tab *FakeTab, js string) error {
+		tab.Title = js
+		return nil
+	}
+
+	if s := layout(t); s != "a *b c d e|*x y" {
+		t.Fatalf("bad layout. Expected=%q, Got=%q", "a *b c d e|*x y", s)
+	}
+
+	// Changes not made via cache aren't seen until TTL expires
+	fb.Wins[0].Tabs[0].Title = "z"
+	tests := []struct {
+		name string
+		fn   func()
+		x    string
+		n    int // expected calls to Backend.Windows
+	}{
+		{"cached", func() {}, "a *b c d e|*x y", 1},
+		{"not expired", func() { setNow(start.Add(4 * time.Second)) }, "a *b c d e|*x y", 1},
+		{"expired", func() { setNow(start.Add(5 * time.Second)) }, "z *b c d e|*x y", 2},
+		{"activate", func() { ActivateTab(1, 3) }, "z b *c d e|*x y", 3},
+		{"close", func() { CloseTab(1, 1) }, "b *c d e|*x y", 4},
+		{"run JS", func() { (&Tab{Index: 1, WindowIndex: 1}).RunJS("r") }, "r *c d e|*x y", 5},
+		{"invalidate", func() { fb.Wins[0].Tabs[0].Title = "s"; c.Invalidate() }, "s *c d e|*x y", 6},
+	}
+	for _, td := range tests {
+		td.fn()
+		if s := layout(t); s != td.x {
+			t.Errorf("%s: bad layout. Expected=%q, Got=%q", td.name, td.x, s)
+		}
+		if cb.windows != td.n {
+			t.Errorf("%s: bad no. of calls. Expected=%d, Got=%d", td.name, td.n, cb.windows)
+		}
+	}
+
+	// Active tab is taken from cached windows
+	tab, err := ActiveTab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.Title != "c" || cb.activeTab != 0 {
+		t.Errorf("bad active tab. Expected=c (0 calls), Got=%s (%d calls)", tab.Title, cb.activeTab)
+	}
+
+	// Returned data are copies
+	wins, _ := Windows()
+	wins[0].Tabs[0].Title = "modified"
+	if s := layout(t); s != "s *c d e|*x y" {
+		t.Errorf("cache modified via result: %q", s)
+	}
+}
+
+func TestCachedBackendDisk(t *testing.T) {
+	fb, cleanup := newTestBackend()
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "cache")
+
+	start := time.Now()
+	defer setNow(start)()
+
+	// newCache simulates a new program run
+	newCache := func() (*CachedBackend, *countingBackend) {
+		cb := &countingBackend{Backend: fb}
+		return NewCachedBackend(cb, 5*time.Second, dir), cb
+	}
+	ctx := context.Background()
+
+	c1, cb1 := newCache()
+	if _, err := c1.ActiveTab(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.Windows(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cb1.windows != 1 || cb1.activeTab != 1 {
+		t.Errorf("bad no. of calls. Expected=1/1, Got=%d/%d", cb1.windows, cb1.activeTab)
+	}
+
+	// Loaded from disk
+	fb.Wins[0].Tabs[0].Title = "z"
+	c2, cb2 := newCache()
+	wins, err := c2.Windows(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := c2.ActiveTab(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wins[0].Tabs[0].Title != "a" || tab.Title != "b" || cb2.windows != 0 || cb2.activeTab != 0 {
+		t.Errorf("not read from disk: %q %q, calls %d/%d", wins[0].Tabs[0].Title, tab.Title, cb2.windows, cb2.activeTab)
+	}
+
+	// Expired
+	restore := setNow(start.Add(time.Minute))
+	c3, cb3 := newCache()
+	if wins, _ = c3.Windows(ctx); wins[0].Tabs[0].Title != "z" || cb3.windows != 1 {
+		t.Errorf("expired cache used: %q, %d calls", wins[0].Tabs[0].Title, cb3.windows)
+	}
+	restore()
+
+	// Invalidated by another program
+	if err := c2.Activate(ctx, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{windowsCacheFile, activeTabCacheFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not deleted: %v", name, err)
+		}
+	}
+	c4, cb4 := newCache()
+	if tab, _ = c4.ActiveTab(ctx); tab.Title != "z" || cb4.activeTab != 1 {
+		t.Errorf("invalidated cache used: %q, %d calls", tab.Title, cb4.activeTab)
+	}
+
+	// Corrupt file is ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, windowsCacheFile), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c5, cb5 := newCache()
+	if _, err := c5.Windows(ctx); err != nil || cb5.windows != 1 {
+		t.Errorf("corrupt cache: %v, %d calls", err, cb5.windows)
+	}
+}
+
+// TestCachedBackendInvalidateError tests that a change that succeeded isn't
+// reported as failed because the cache couldn't be cleared.
+func TestCachedBackendInvalidateError(t *testing.T) {
+	fb, cleanup := newTestBackend()
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A non-empty directory can't be removed like a cache file
+	if err := os.MkdirAll(filepath.Join(dir, windowsCacheFile, "x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCachedBackend(fb, 5*time.Second, dir)
+	SetBackend(c)
+	if err := CloseTab(1, 1); err != nil {
+		t.Errorf("close failed: %v", err)
+	}
+	if s := layout(t); s != "*b c d e|*x y" {
+		t.Errorf("bad layout. Expected=%q, Got=%q", "*b c d e|*x y", s)
+	}
+	if err := c.Invalidate(); err == nil {
+		t.Error("Invalidate didn't return error")
+	}
+}
+
+// TestCachedBackendResolve tests that Tab's methods find the tab in
+// Safari's current windows, not the cached ones.
+func TestCachedBackendResolve(t *testing.T) {
+	fb, cleanup := newTestBackend()
+	defer cleanup()
+
+	SetBackend(NewCachedBackend(fb, time.Minute, ""))
+	findTab(t, "a") // cache windows
+	// Closed behind the cache's back, so d is now 1x3
+	fb.Wins[0].Tabs = append(fb.Wins[0].Tabs[:2], fb.Wins[0].Tabs[3:]...)
+
+	d := findTab(t, "d")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Index != 3 {
+		t.Errorf("bad index. Expected=3, Got=%d", d.Index)
+	}
+	if s := layout(t); s != "a *b e|*x y" {
+		t.Errorf("bad layout. Expected=%q, Got=%q", "a *b e|*x y", s)
+	}
+}
@@ -2,11 +2,15 @@
 // MIT Licence applies http://opensource.org/licenses/MIT
 
 // Package cloud provides access to Safari's iCloud Tabs.
+//
+// The package-level functions use the default CloudTabs, which is opened
+// the first time it's needed. Importing the package has no side effects.
 package cloud
 
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -16,53 +20,147 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	// sqlite3 registers itself with sql
 	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/deanishe/go-safari/internal/errs"
 )
 
 var (
 	// DefaultTabsPath is the path to the default CloudTabs database.
 	DefaultTabsPath = filepath.Join(os.Getenv("HOME"), "Library/Safari/CloudTabs.db")
-	hostname        string
-	tabs            *CloudTabs
+
+	// Default CloudTabs, opened on first successful use
+	tabs   *CloudTabs
+	tabsMu sync.Mutex
+
+	// Name of this computer, read on first successful use
+	hostname   string
+	hostnameMu sync.Mutex
 )
 
-func init() {
-	var (
-		data []byte
-		err  error
-	)
-	tabs, err = New(DefaultTabsPath)
-	if err != nil {
-		panic(err)
+// Errors returned by the package. They are the same values as those
+// returned by package safari. Use errors.Is to check for them.
+var (
+	ErrNotFound          = errs.ErrNotFound
+	ErrPermissionDenied  = errs.ErrPermissionDenied
+	ErrUnsupportedSchema = errs.ErrUnsupportedSchema
+)
+
+// OpenError is returned when a CloudTabs database can't be opened.
+type OpenError = errs.OpenError
+
+// DeviceNameError is returned when the name of this computer can't be
+// determined, e.g. because /usr/sbin/scutil doesn't exist.
+type DeviceNameError struct {
+	Err error // Underlying error
+}
+
+// Error implements error.
+func (e *DeviceNameError) Error() string {
+	return fmt.Sprintf("couldn't get computer name: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DeviceNameError) Unwrap() error { return e.Err }
+
+// Default returns the default CloudTabs, which reads DefaultTabsPath.
+// The database is opened on the first successful call, and the same
+// CloudTabs is returned by subsequent calls. If it can't be opened, the
+// next call tries again.
+func Default() (*CloudTabs, error) {
+	return defaultContext(context.Background())
+}
+
+// defaultContext is like Default, but the database is opened with ctx.
+func defaultContext(ctx context.Context) (*CloudTabs, error) {
+	tabsMu.Lock()
+	defer tabsMu.Unlock()
+
+	if tabs == nil {
+		c, err := NewContext(ctx, DefaultTabsPath)
+		if err != nil {
+			return nil, err
+		}
+		tabs = c
+	}
+	return tabs, nil
+}
+
+// computerName returns the name of this computer, which is also the name of
+// its device in the CloudTabs database. scutil is killed if ctx is cancelled.
+func computerName(ctx context.Context) (string, error) {
+	hostnameMu.Lock()
+	defer hostnameMu.Unlock()
+
+	if hostname != "" {
+		return hostname, nil
 	}
-	data, err = exec.Command("/usr/sbin/scutil", "--get", "ComputerName").Output()
+	data, err := exec.CommandContext(ctx, "/usr/sbin/scutil", "--get", "ComputerName").Output()
 	if err != nil {
-		panic(err)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", &DeviceNameError{err}
 	}
 	hostname = strings.TrimSpace(string(data))
+	return hostname, nil
 }
 
 // CloudTabs is a collection of Tabs.
 type CloudTabs struct {
 	DB *sql.DB
+	// LocalDevice is the name of this computer, whose tabs are ignored.
+	// If empty, the computer name is read with scutil.
+	LocalDevice string
 }
 
 // New creates a new Tabs from a Safari CloudTabs.db database.
+// It returns an *OpenError if the database can't be opened.
 func New(filename string) (*CloudTabs, error) {
+	return NewContext(context.Background(), filename)
+}
+
+// NewContext is like New, but aborts if ctx is cancelled while the
+// database is being opened.
+func NewContext(ctx context.Context, filename string) (*CloudTabs, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, &OpenError{Path: filename, Err: errs.File(err)}
+	}
 	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&cache=shared&_timeout=9999999&_journal=WAL", filename))
 	if err != nil {
-		return nil, fmt.Errorf("couldn't open database %s: %s", filename, err)
+		return nil, &OpenError{Path: filename, Err: err}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, &OpenError{Path: filename, Err: errs.SQL(err)}
 	}
-	return &CloudTabs{db}, nil
+	return &CloudTabs{DB: db}, nil
 }
 
 // Tabs returns all Cloud Tabs. Tabs for the current device are ignored.
-func Tabs() ([]*Tab, error) { return tabs.Tabs() }
+func Tabs() ([]*Tab, error) {
+	return TabsContext(context.Background())
+}
+
+// TabsContext is like Tabs, but aborts if ctx is cancelled.
+func TabsContext(ctx context.Context) ([]*Tab, error) {
+	c, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.TabsContext(ctx)
+}
 
 // Tabs returns all Cloud Tabs. Tabs for the current device are ignored.
 func (c *CloudTabs) Tabs() ([]*Tab, error) {
+	return c.TabsContext(context.Background())
+}
+
+// TabsContext is like Tabs, but aborts if ctx is cancelled.
+func (c *CloudTabs) TabsContext(ctx context.Context) ([]*Tab, error) {
 	var (
 		q = `
 		SELECT t.title, t.url, t.position, d.device_name
@@ -77,14 +175,24 @@ func (c *CloudTabs) Tabs() ([]*Tab, error) {
 		tabs               []*Tab
 	)
 
-	rows, err := c.DB.Query(q, hostname)
+	local := c.LocalDevice
+	if local == "" {
+		var err error
+		if local, err = computerName(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := c.DB.QueryContext(ctx, q, local)
 	if err != nil {
-		return nil, fmt.Errorf("error running query:%s error: %s", q, err)
+		return nil, fmt.Errorf("error running query:%s error: %w", q, errs.SQL(err))
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		rows.Scan(&title, &url, &position, &device)
+		if err := rows.Scan(&title, &url, &position, &device); err != nil {
+			return nil, errs.SQL(err)
+		}
 		tab = &Tab{Title: title, URL: url, Device: device}
 		sData, err := parsePosition(position)
 		if err != nil {
@@ -95,6 +203,9 @@ func (c *CloudTabs) Tabs() ([]*Tab, error) {
 		}
 		tabs = append(tabs, tab)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.SQL(err)
+	}
 
 	sort.Sort(ByDeviceIndex(tabs))
 
@@ -132,7 +243,7 @@ type Tab struct {
 type sortData struct {
 	ChangeID  int    `json:"changeID"`
 	SortValue int    `json:"sortValue"`
-	Device    string `json"deviceIdentifier"`
+	Device    string `json:"deviceIdentifier"`
 }
 
 // Parse the `position` blob. It's zlib-compressed JSON.
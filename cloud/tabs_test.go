@@ -3,24 +3,37 @@
 
 package cloud
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
 
 func TestTabs(t *testing.T) {
-	c, err := New(DefaultTabsPath)
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+
+	c, err := New(filepath.Join(dir, fixtures.CloudTabsFile))
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer c.DB.Close()
 
+	c.LocalDevice = fixtures.LocalDevice
 	tabs, err := c.Tabs()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(tabs) == 0 {
-		t.Errorf("no cloud tabs found")
+	x := fixtures.CloudTabs[:len(fixtures.CloudTabs)-1]
+	if len(tabs) != len(x) {
+		t.Fatalf("bad no. of tabs. Expected=%d, Got=%d", len(x), len(tabs))
 	}
 
-	for _, tab := range tabs {
+	for i, tab := range tabs {
 		if tab.Title == "" {
 			t.Errorf("tab has no title: %#v", tab)
 		}
@@ -30,5 +43,37 @@ func TestTabs(t *testing.T) {
 		if tab.Device == "" {
 			t.Errorf("tab has no device: %#v", tab)
 		}
+		if tab.Device == fixtures.LocalDevice {
+			t.Errorf("tab from local device: %#v", tab)
+		}
+		if tab.Title != x[i].Title || tab.Device != x[i].Device || tab.SortIndex != x[i].SortValue {
+			t.Errorf("bad tab %d. Expected=%+v, Got=%+v", i, x[i], tab)
+		}
+	}
+}
+
+func TestNewMissing(t *testing.T) {
+	if _, err := New("/does/not/exist.db"); err == nil {
+		t.Error("opened non-existent database")
+	} else if _, ok := err.(*OpenError); !ok {
+		t.Errorf("bad error type: %T", err)
+	}
+}
+
+func TestTabsContext(t *testing.T) {
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+
+	c, err := New(filepath.Join(dir, fixtures.CloudTabsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.DB.Close()
+	c.LocalDevice = fixtures.LocalDevice
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.TabsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected=%v, Got=%v", context.Canceled, err)
 	}
 }
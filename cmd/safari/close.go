@@ -0,0 +1,89 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doCloseWhere closes the tabs matched by the close command's filter flags.
+// If several flags are given, tabs must match all of them. With --dry-run,
+// the matching tabs are printed instead.
+func doCloseWhere() error {
+
+	var filters []func(*safari.Tab) bool
+
+	if closeDomain != "" {
+		domain := strings.ToLower(strings.TrimPrefix(closeDomain, "."))
+		filters = append(filters, func(t *safari.Tab) bool {
+			u, err := url.Parse(t.URL)
+			if err != nil {
+				return false
+			}
+			host := strings.ToLower(u.Hostname())
+			return host == domain || strings.HasSuffix(host, "."+domain)
+		})
+	}
+
+	if closeURLRegex != "" {
+		rx, err := regexp.Compile(closeURLRegex)
+		if err != nil {
+			return fmt.Errorf("invalid --url-regex: %v", err)
+		}
+		filters = append(filters, func(t *safari.Tab) bool { return rx.MatchString(t.URL) })
+	}
+
+	if closeTitle != "" {
+		title := strings.ToLower(closeTitle)
+		filters = append(filters, func(t *safari.Tab) bool {
+			return strings.Contains(strings.ToLower(t.Title), title)
+		})
+	}
+
+	// Must be last, so only tabs matching the other filters are compared
+	if closeDuplicates {
+		seen := map[string]bool{}
+		filters = append(filters, func(t *safari.Tab) bool {
+			if seen[t.URL] {
+				return true
+			}
+			seen[t.URL] = true
+			return false
+		})
+	}
+
+	match := func(t *safari.Tab) bool {
+		for _, fn := range filters {
+			if !fn(t) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var (
+		tabs []*safari.Tab
+		err  error
+	)
+	if closeDryRun {
+		tabs, err = safari.TabsWhere(match)
+	} else {
+		tabs, err = safari.CloseTabsWhere(match)
+	}
+
+	for _, t := range tabs {
+		if closeDryRun {
+			fmt.Printf("%dx%d %s (%s)\n", t.WindowIndex, t.Index, t.Title, t.URL)
+		} else {
+			log.Printf("closed %dx%d %s (%s)", t.WindowIndex, t.Index, t.Title, t.URL)
+		}
+	}
+	return err
+}
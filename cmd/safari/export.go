@@ -0,0 +1,30 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doExport writes bookmarks to STDOUT or exportPath in exportFormat.
+// An existing file at exportPath is only replaced if the export succeeds.
+func doExport() error {
+
+	if exportFormat != "html" {
+		return fmt.Errorf("unknown format: %s", exportFormat)
+	}
+
+	p, err := safari.New()
+	if err != nil {
+		return err
+	}
+
+	if exportPath == "" {
+		return p.ExportHTML(os.Stdout)
+	}
+	return p.ExportHTMLFile(exportPath)
+}
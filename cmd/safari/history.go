@@ -32,7 +32,14 @@ func doSearchHistory() error {
 
 	fmt.Fprintf(os.Stderr, "searching for %q ...\n", searchQuery)
 
-	entries, err := h.Search(searchQuery)
+	search := h.Search
+	if historyUnique {
+		search = h.SearchUnique
+	}
+	if historyRanked {
+		search = h.SearchRanked
+	}
+	entries, err := search(searchQuery)
 	if err != nil {
 		return err
 	}
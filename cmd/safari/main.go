@@ -6,7 +6,7 @@
 // Created on 2016-05-29
 //
 
-// Command safari lists Safari's bookmarks and reading list, and lists, activates and closes tabs.
+// Command safari lists Safari's bookmarks and reading list, and lists, opens, activates, navigates, moves, sorts and closes tabs.
 //
 // The list command outputs human-readable data by default, but can also
 // generate JSON for use from other programs.
@@ -41,11 +41,37 @@ var (
 	listContentType      string
 	closeTargetType      string
 	searchQuery          string
+	historyUnique        bool
+	historyRanked        bool
+	exportFormat         string
+	rlUnread             bool
+	rlSort               string
+	rlOlderThan          int
+	readlistUID          string
+	exportPath           string
+	searchSources        []string
+	searchTimeout        time.Duration
+	openTargets          []string
+	openNewWindow        bool
+	openPrivate          bool
+	openBackground       bool
+	tabAction, tabURL    string
+	moveToWin, moveToTab int
+	moveNewWindow        bool
+	sortKey              string
+	closeDomain          string
+	closeURLRegex        string
+	closeTitle           string
+	closeDuplicates      bool
+	closeDryRun          bool
 
 	// Kingpin components
 	app                            *kingpin.Application
 	activateCmd, listCmd, closeCmd *kingpin.CmdClause
-	historyCmd                     *kingpin.CmdClause
+	historyCmd, exportCmd          *kingpin.CmdClause
+	searchCmd, openCmd, tabCmd     *kingpin.CmdClause
+	moveCmd, sortCmd               *kingpin.CmdClause
+	readCmd, unreadCmd, removeCmd  *kingpin.CmdClause
 
 	// Colours
 	yellow  = color.New(color.FgYellow)
@@ -78,25 +104,89 @@ func init() {
 	activateCmd.Arg("window", "The window to activate.").Required().IntVar(&targetWin)
 	activateCmd.Arg("tab", "The tab to activate.").IntVar(&targetTab)
 
+	// Open
+	openCmd = app.Command("open", "Open URLs, bookmarks or bookmark folders in Safari.").Alias("o")
+	openCmd.Arg("target", "URL, or UID of a bookmark or folder. A folder's bookmarks, including those in sub-folders, are opened as tabs.").Required().StringsVar(&openTargets)
+	openCmd.Flag("window", "Open in a new tab in this window.").Short('w').Default("1").IntVar(&targetWin)
+	openCmd.Flag("new-window", "Open in a new window.").Short('n').BoolVar(&openNewWindow)
+	openCmd.Flag("private", "Open in a new private window.").Short('p').BoolVar(&openPrivate)
+	openCmd.Flag("background", "Don't make the new tab current or activate Safari.").Short('b').BoolVar(&openBackground)
+
+	// Tab
+	tabCmd = app.Command("tab", "Navigate, reload or stop a tab.").Alias("t")
+	tabCmd.Arg("window", "The target window.").Required().IntVar(&targetWin)
+	tabCmd.Arg("tab", "The target tab.").Required().IntVar(&targetTab)
+	tabCmd.Arg("action", "What to do (navigate, reload, back, forward or stop).").
+		Required().
+		EnumVar(&tabAction, "navigate", "reload", "back", "forward", "stop")
+	tabCmd.Arg("url", "URL to navigate to.").StringVar(&tabURL)
+
+	// Move
+	moveCmd = app.Command("move", "Move a tab within its window, to another window or to a new window.").Alias("m")
+	moveCmd.Arg("window", "The window containing the tab.").Required().IntVar(&targetWin)
+	moveCmd.Arg("tab", "The tab to move.").Required().IntVar(&targetTab)
+	moveCmd.Flag("new-window", "Move the tab to a new window.").Short('n').BoolVar(&moveNewWindow)
+	moveCmd.Arg("to-window", "The window to move the tab to. 0 means the frontmost window.").IntVar(&moveToWin)
+	moveCmd.Arg("to-tab", "The tab's new position. 0 means the end of the window.").IntVar(&moveToTab)
+
+	// Sort tabs
+	sortCmd = app.Command("sort-tabs", "Sort a window's tabs.")
+	sortCmd.Arg("window", "The window whose tabs to sort.").Default("1").IntVar(&targetWin)
+	sortCmd.Flag("by", "What to sort by (title, url or host).").
+		Short('b').
+		Default("title").
+		EnumVar(&sortKey, "title", "url", "host")
+
 	// List
 	listCmd = app.Command("list", "List Safari bookmarks, folders, tabs or cloud tabs.").Alias("l")
 	listCmd.Flag("json", "Output JSON, not text.").Short('j').BoolVar(&outputJSON)
 	listCmd.Arg("type", "Type of data to list (bookmarks, folders, readlist, tabs or cloud-tabs).").
 		Required().
 		EnumVar(&listContentType, "b", "bookmarks", "f", "folders", "r", "readlist", "t", "tabs", "c", "cloud-tabs")
+	listCmd.Flag("unread", "Only list unread Reading List items.").Short('u').BoolVar(&rlUnread)
+	listCmd.Flag("sort", "Sort Reading List items (added).").Short('s').EnumVar(&rlSort, "added")
+	listCmd.Flag("older-than", "Only list Reading List items added more than this many days ago.").IntVar(&rlOlderThan)
 
 	// Close
 	closeCmd = app.Command("close", "Close Safari windows and/or tabs.").Alias("c")
-	closeCmd.Arg("what", "What to close (win, tab, tabs-other, tabs-left or tabs-right).").
-		Required().
+	closeCmd.Arg("what", "What to close (win, tab, tabs-other, tabs-left or tabs-right). Not used with filter flags.").
 		EnumVar(&closeTargetType, "w", "win", "t", "tab", "to", "tabs-other",
 			"tl", "tabs-left", "tr", "tabs-right")
 	closeCmd.Arg("window", "The target window.").Default("1").IntVar(&targetWin)
 	closeCmd.Arg("tab", "The target tab.").IntVar(&targetTab)
+	closeCmd.Flag("domain", "Close tabs in all windows whose host is this domain or a subdomain of it.").StringVar(&closeDomain)
+	closeCmd.Flag("url-regex", "Close tabs in all windows whose URL matches this regular expression.").StringVar(&closeURLRegex)
+	closeCmd.Flag("title", "Close tabs in all windows whose title contains this text (case-insensitive).").StringVar(&closeTitle)
+	closeCmd.Flag("duplicates", "Close tabs in all windows with the same URL as an earlier tab.").BoolVar(&closeDuplicates)
+	closeCmd.Flag("dry-run", "Show which tabs the filter flags match, but don't close them.").Short('n').BoolVar(&closeDryRun)
 
 	// History (search)
 	historyCmd = app.Command("history", "Search Safari history").Alias("h")
 	historyCmd.Arg("query", "Search query").Required().StringVar(&searchQuery)
+	historyCmd.Flag("unique", "Show each URL only once.").Short('u').BoolVar(&historyUnique)
+	historyCmd.Flag("ranked", "Show each URL only once, most relevant first.").Short('r').BoolVar(&historyRanked)
+
+	// Search
+	searchCmd = app.Command("search", "Search tabs, bookmarks, Reading List, history and cloud tabs.").Alias("s")
+	searchCmd.Arg("query", "Search query").Required().StringVar(&searchQuery)
+	searchCmd.Flag("source", "Only search this source (tabs, bookmarks, readinglist, history or cloud-tabs). May be repeated.").
+		EnumsVar(&searchSources, "tabs", "bookmarks", "readinglist", "history", "cloud-tabs")
+	searchCmd.Flag("timeout", "Maximum time to wait for each source.").Default("2s").DurationVar(&searchTimeout)
+	searchCmd.Flag("json", "Output JSON, not text.").Short('j').BoolVar(&outputJSON)
+
+	// Reading List
+	readlistCmd := app.Command("readlist", "Mark Reading List items read or unread, or remove them.").Alias("r")
+	readCmd = readlistCmd.Command("mark-read", "Mark a Reading List item as read.")
+	readCmd.Arg("uid", "UID of the Reading List item.").Required().StringVar(&readlistUID)
+	unreadCmd = readlistCmd.Command("mark-unread", "Mark a Reading List item as unread.")
+	unreadCmd.Arg("uid", "UID of the Reading List item.").Required().StringVar(&readlistUID)
+	removeCmd = readlistCmd.Command("remove", "Remove an item from the Reading List.")
+	removeCmd.Arg("uid", "UID of the Reading List item.").Required().StringVar(&readlistUID)
+
+	// Export
+	exportCmd = app.Command("export", "Export bookmarks and Reading List.").Alias("e")
+	exportCmd.Flag("format", "Export format (html).").Short('f').Default("html").EnumVar(&exportFormat, "html")
+	exportCmd.Flag("output", "File to write to (default=STDOUT).").Short('o').StringVar(&exportPath)
 }
 
 // node is for pretty-printing trees of colourful strings.
@@ -236,11 +326,12 @@ func doListTabs() error {
 // jsonBookmark is a wrapper for safari.Bookmark that eliminates the circular
 // references.
 type jsonBookmark struct {
-	Title     string
-	URL       string
-	Ancestors []string
-	Preview   string
-	UID       string
+	Title       string
+	URL         string
+	Ancestors   []string
+	Preview     string
+	UID         string
+	ReadingList *safari.ReadingListInfo `json:",omitempty"`
 }
 
 // newJSONBookmark populates an jsonBookmark based on a safari.Bookmark.
@@ -250,11 +341,12 @@ func newJSONBookmark(bm *safari.Bookmark) *jsonBookmark {
 		ancestors = append(ancestors, f.Title())
 	}
 	return &jsonBookmark{
-		Title:     bm.Title(),
-		URL:       bm.URL,
-		Ancestors: ancestors,
-		Preview:   bm.Preview,
-		UID:       bm.UID()}
+		Title:       bm.Title(),
+		URL:         bm.URL,
+		Ancestors:   ancestors,
+		Preview:     bm.Preview,
+		UID:         bm.UID(),
+		ReadingList: bm.ReadingList}
 
 }
 
@@ -350,11 +442,36 @@ func doListReadingList() error {
 		return err
 	}
 
-	f := p.ReadingList
+	bookmarks := p.ReadingList.Bookmarks
+	if rlSort == "added" {
+		bookmarks = p.ReadingListByDateAdded()
+	}
+
+	var (
+		unread = map[*safari.Bookmark]bool{}
+		old    = map[*safari.Bookmark]bool{}
+	)
+	for _, bm := range p.ReadingListUnread() {
+		unread[bm] = true
+	}
+	for _, bm := range p.ReadingListOlderThan(time.Duration(rlOlderThan) * 24 * time.Hour) {
+		old[bm] = true
+	}
+
+	filtered := []*safari.Bookmark{}
+	for _, bm := range bookmarks {
+		if rlUnread && !unread[bm] {
+			continue
+		}
+		if rlOlderThan > 0 && !old[bm] {
+			continue
+		}
+		filtered = append(filtered, bm)
+	}
 
 	if outputJSON {
 		output := []*jsonBookmark{}
-		for _, bm := range f.Bookmarks {
+		for _, bm := range filtered {
 			if bm.IsBookmarklet() {
 				continue
 			}
@@ -364,10 +481,17 @@ func doListReadingList() error {
 		return printJSON(output)
 	}
 
-	fStr := fmt.Sprintf("[%%%dd] %%s\n", len(fmt.Sprintf("%d", len(f.Bookmarks))))
+	fStr := fmt.Sprintf("[%%%dd] %%s %%s%%s\n", len(fmt.Sprintf("%d", len(filtered))))
 
-	for i, bm := range f.Bookmarks {
-		fmt.Printf(fStr, i+1, bm.Title())
+	for i, bm := range filtered {
+		var added, read string
+		if bm.ReadingList != nil {
+			added = bm.ReadingList.DateAdded.Local().Format("2006-01-02")
+			if !bm.ReadingList.Unread() {
+				read = " (read)"
+			}
+		}
+		fmt.Printf(fStr, i+1, added, bm.Title(), read)
 	}
 	// printFolder(p.BookmarksBar, false)
 
@@ -408,10 +532,23 @@ func doList() error {
 // doClose closes the specified window/tab(s).
 func doClose() error {
 
+	if closeDomain != "" || closeURLRegex != "" || closeTitle != "" || closeDuplicates {
+		if closeTargetType != "" {
+			return fmt.Errorf("can't use %s with filter flags", closeTargetType)
+		}
+		return doCloseWhere()
+	}
+	if closeDryRun {
+		return fmt.Errorf("--dry-run requires a filter flag")
+	}
+
 	log.Printf("target=%s, win=%d, tab=%d", closeTargetType, targetWin, targetTab)
 
 	switch closeTargetType {
 
+	case "":
+		return fmt.Errorf("specify what to close or a filter flag")
+
 	case "w", "win":
 		return safari.CloseWin(targetWin)
 
@@ -450,6 +587,22 @@ func main() {
 		err = doActivate()
 		app.FatalIfError(err, "%s", "Safari command failed")
 
+	case openCmd.FullCommand():
+		err = doOpen()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
+	case tabCmd.FullCommand():
+		err = doTab()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
+	case moveCmd.FullCommand():
+		err = doMove()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
+	case sortCmd.FullCommand():
+		err = doSortTabs()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
 	case closeCmd.FullCommand():
 		err = doClose()
 		app.FatalIfError(err, "%s", "Safari command failed")
@@ -462,6 +615,18 @@ func main() {
 		err = doSearchHistory()
 		app.FatalIfError(err, "%s", "Safari command failed")
 
+	case searchCmd.FullCommand():
+		err = doSearch()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
+	case readCmd.FullCommand(), unreadCmd.FullCommand(), removeCmd.FullCommand():
+		err = doReadingList(strings.TrimPrefix(cmd, "readlist "))
+		app.FatalIfError(err, "%s", "Safari command failed")
+
+	case exportCmd.FullCommand():
+		err = doExport()
+		app.FatalIfError(err, "%s", "Safari command failed")
+
 	default:
 		fmt.Printf("json=%v", outputJSON)
 	}
@@ -0,0 +1,26 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"log"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doMove moves the specified tab.
+func doMove() error {
+	if moveNewWindow {
+		log.Printf("move %dx%d to new window", targetWin, targetTab)
+		return safari.MoveTabToNewWindow(targetWin, targetTab)
+	}
+	log.Printf("move %dx%d to %dx%d", targetWin, targetTab, moveToWin, moveToTab)
+	return safari.MoveTab(targetWin, targetTab, moveToWin, moveToTab)
+}
+
+// doSortTabs sorts the tabs in the specified window.
+func doSortTabs() error {
+	log.Printf("sort tabs in window %d by %s", targetWin, sortKey)
+	return safari.SortTabs(targetWin, safari.SortKey(sortKey))
+}
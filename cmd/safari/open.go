@@ -0,0 +1,140 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doOpen opens URLs, bookmarks and bookmark folders in Safari.
+func doOpen() error {
+
+	urls, err := openURLs(openTargets)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("nothing to open")
+	}
+
+	opts := []safari.OpenOption{
+		safari.InWindow(targetWin),
+		safari.InNewWindow(openNewWindow),
+		safari.InPrivateWindow(openPrivate),
+		safari.InBackground(openBackground),
+	}
+
+	for i, URL := range urls {
+		tab, err := safari.OpenURL(URL, opts...)
+		if err != nil {
+			return err
+		}
+		log.Printf("opened %s in %dx%d", URL, tab.WindowIndex, tab.Index)
+
+		// Open the rest in the same window
+		if i == 0 {
+			opts = []safari.OpenOption{
+				safari.InWindow(tab.WindowIndex),
+				safari.InBackground(openBackground),
+			}
+		}
+	}
+	return nil
+}
+
+// newParser loads Safari's bookmarks. Tests replace it.
+var newParser = func() (*safari.Parser, error) { return safari.New() }
+
+// openURLs returns the URLs to open for targets, which are URLs or the
+// UIDs of bookmarks or folders. Folders are opened as one tab per bookmark,
+// including bookmarks in sub-folders.
+func openURLs(targets []string) ([]string, error) {
+
+	var (
+		p    *safari.Parser
+		urls []string
+		err  error
+	)
+
+	for _, s := range targets {
+		if URL := targetURL(s); URL != "" {
+			urls = append(urls, URL)
+			continue
+		}
+
+		if p == nil {
+			if p, err = newParser(); err != nil {
+				return nil, err
+			}
+		}
+
+		if bm := p.BookmarkForUID(s); bm != nil {
+			urls = append(urls, bm.URL)
+			continue
+		}
+
+		f := p.FolderForUID(s)
+		if f == nil {
+			return nil, fmt.Errorf("not a URL or bookmark/folder UID: %s", s)
+		}
+		l := folderURLs(f)
+		if len(l) == 0 {
+			return nil, fmt.Errorf("no bookmarks in folder: %s", f.Title())
+		}
+		urls = append(urls, l...)
+	}
+
+	return urls, nil
+}
+
+// folderURLs returns the URLs of the bookmarks in f and its sub-folders,
+// ignoring bookmarklets.
+func folderURLs(f *safari.Folder) []string {
+	var urls []string
+	for _, bm := range f.Bookmarks {
+		if !bm.IsBookmarklet() {
+			urls = append(urls, bm.URL)
+		}
+	}
+	for _, sub := range f.Folders {
+		urls = append(urls, folderURLs(sub)...)
+	}
+	return urls
+}
+
+// targetURL returns the URL to open for target s if s is a URL. URLs
+// without a scheme, e.g. "example.com/page" or "localhost:8080", are
+// opened with https. It returns "" if s may be the UID of a bookmark or
+// folder, which contain neither "." nor ":".
+func targetURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && !isPort(u.Opaque) {
+		return s
+	}
+	if strings.ContainsAny(s, ".:/") {
+		return "https://" + s
+	}
+	return ""
+}
+
+// isPort returns true if s starts with a port number, i.e. the string it
+// was parsed from was host:port, not scheme:data.
+func isPort(s string) bool {
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deanishe/go-safari"
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+func TestOpenURLs(t *testing.T) {
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+
+	var loads int
+	prev := newParser
+	newParser = func() (*safari.Parser, error) {
+		loads++
+		return safari.New(safari.BookmarksPath(filepath.Join(dir, fixtures.BookmarksFile)))
+	}
+	defer func() { newParser = prev }()
+
+	tests := []struct {
+		target string
+		x      string
+		loads  int // expected no. of times bookmarks are loaded
+	}{
+		{"https://www.example.com/page", "https://www.example.com/page", 0},
+		{"about:blank", "about:blank", 0},
+		{"example.com", "https://example.com", 0},
+		{"example.com/page?q=1", "https://example.com/page?q=1", 0},
+		{"localhost:8080", "https://localhost:8080", 0},
+		{"example.com:8080/page", "https://example.com:8080/page", 0},
+		{"BM2", "https://wiki.example.com/", 1},
+		{"WORK", "https://wiki.example.com/", 1},
+		{"BAR", "https://www.example.com/ https://wiki.example.com/", 1}, // bookmarklet ignored
+	}
+
+	for _, td := range tests {
+		loads = 0
+		urls, err := openURLs([]string{td.target})
+		if err != nil {
+			t.Errorf("%s: %v", td.target, err)
+			continue
+		}
+		if s := strings.Join(urls, " "); s != td.x {
+			t.Errorf("%s: bad URLs. Expected=%q, Got=%q", td.target, td.x, s)
+		}
+		if loads != td.loads {
+			t.Errorf("%s: bad no. of loads. Expected=%d, Got=%d", td.target, td.loads, loads)
+		}
+	}
+
+	// Bookmarks are loaded once
+	loads = 0
+	urls, err := openURLs([]string{"BM1", "example.org", "BM2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 3 || loads != 1 {
+		t.Errorf("bad multiple targets: %v, %d loads", urls, loads)
+	}
+
+	if _, err := openURLs([]string{"NOPE"}); err == nil {
+		t.Error("unknown UID accepted")
+	}
+	if _, err := openURLs([]string{"MENU"}); err == nil {
+		t.Error("empty folder accepted")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doReadingList marks a Reading List item read/unread or removes it.
+func doReadingList(action string) error {
+
+	p, err := safari.New()
+	if err != nil {
+		return err
+	}
+
+	bm := p.BookmarkForUID(readlistUID)
+	if bm == nil {
+		return fmt.Errorf("no bookmark with UID %s", readlistUID)
+	}
+
+	switch action {
+
+	case "mark-read":
+		err = p.MarkRead(bm)
+
+	case "mark-unread":
+		err = p.MarkUnread(bm)
+
+	case "remove":
+		err = p.RemoveFromReadingList(bm)
+
+	default:
+		err = fmt.Errorf("unknown action: %s", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.Save(); err != nil {
+		return err
+	}
+	log.Printf("%s: %q", action, bm.Title())
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/deanishe/go-safari/search"
+)
+
+// doSearch searches all (or searchSources) sources for searchQuery.
+func doSearch() error {
+
+	s := search.New()
+	s.Timeout = searchTimeout
+
+	var sources []search.Source
+	for _, src := range searchSources {
+		sources = append(sources, search.Source(src))
+	}
+
+	results, err := s.Search(context.Background(), searchQuery, sources...)
+	var errs search.Errors
+	if errors.As(err, &errs) {
+		// Some sources failed. Show the results from the others.
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "error searching %v\n", e)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if outputJSON {
+		if results == nil {
+			results = []*search.Result{}
+		}
+		return printJSON(results)
+	}
+
+	for i, r := range results {
+		fmt.Printf("[%d/%d] %s %q (%s)\n", i+1, len(results), cyan.Sprint(r.Source), r.Title, r.URL)
+	}
+
+	return nil
+}
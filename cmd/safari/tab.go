@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/deanishe/go-safari"
+)
+
+// doTab navigates, reloads or stops the specified tab.
+func doTab() error {
+
+	if tabURL != "" && tabAction != "navigate" {
+		return fmt.Errorf("%s doesn't take a URL", tabAction)
+	}
+
+	tab := &safari.Tab{WindowIndex: targetWin, Index: targetTab}
+	if tabURL != "" {
+		log.Printf("%s %dx%d %s", tabAction, targetWin, targetTab, tabURL)
+	} else {
+		log.Printf("%s %dx%d", tabAction, targetWin, targetTab)
+	}
+
+	switch tabAction {
+
+	case "navigate":
+		if tabURL == "" {
+			return fmt.Errorf("navigate requires a URL")
+		}
+		return tab.Navigate(tabURL)
+
+	case "reload":
+		return tab.Reload()
+
+	case "back":
+		return tab.Back()
+
+	case "forward":
+		return tab.Forward()
+
+	case "stop":
+		return tab.Stop()
+
+	default:
+		return fmt.Errorf("unknown action: %s", tabAction)
+	}
+}
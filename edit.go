@@ -0,0 +1,501 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-16
+//
+
+package safari
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Keys used in Bookmarks.plist.
+const (
+	keyChildren   = "Children"
+	keyTitle      = "Title"
+	keyType       = "WebBookmarkType"
+	keyURL        = "URLString"
+	keyUUID       = "WebBookmarkUUID"
+	keyURIDict    = "URIDictionary"
+	keyReadingLst = "ReadingList"
+	keyDateAdded  = "DateAdded"
+)
+
+// Edits are made to the untyped data in Parser.data, not to Parser.raw,
+// so that any keys this package doesn't know about survive the round trip.
+// After each edit, the Folder and Bookmark trees are rebuilt from the data.
+//
+// Items are looked up by UID, so Folders and Bookmarks obtained before an
+// edit may still be passed to the editing methods afterwards.
+
+// AddFolder creates a new Folder called title in Folder parent. If parent
+// is nil, the new Folder is created at the top level. Folders cannot be
+// created in the Reading List.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) AddFolder(parent *Folder, title string) (*Folder, error) {
+	if parent != nil && parent.IsReadingList() {
+		return nil, fmt.Errorf("can't add folder %q to Reading List", title)
+	}
+	children, err := p.childrenOf(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := newUID()
+	if err != nil {
+		return nil, err
+	}
+
+	children.set(append(children.get(), newFolderEntry(uid, title)))
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p.FolderForUID(uid), nil
+}
+
+// AddBookmark creates a new Bookmark in Folder folder. If folder is nil,
+// the Bookmark is created at the top level.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) AddBookmark(folder *Folder, title, URL string) (*Bookmark, error) {
+	children, err := p.childrenOf(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := newUID()
+	if err != nil {
+		return nil, err
+	}
+
+	rl := folder != nil && folder.IsReadingList()
+	children.set(append(children.get(), newBookmarkEntry(uid, title, URL, rl)))
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p.BookmarkForUID(uid), nil
+}
+
+// EditBookmark sets the title and URL of Bookmark bm.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) EditBookmark(bm *Bookmark, title, URL string) error {
+	d, _, err := p.findItem(bm)
+	if err != nil {
+		return err
+	}
+
+	uri, ok := d[keyURIDict].(map[string]interface{})
+	if !ok {
+		uri = map[string]interface{}{}
+		d[keyURIDict] = uri
+	}
+	uri["title"] = title
+	if _, ok := d[keyTitle]; ok {
+		d[keyTitle] = title
+	}
+	d[keyURL] = URL
+
+	return p.reload()
+}
+
+// RenameFolder sets the title of Folder f. The special top-level folders
+// (Bookmarks Bar, Bookmarks Menu and Reading List) cannot be renamed.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) RenameFolder(f *Folder, title string) error {
+	d, _, err := p.findItem(f)
+	if err != nil {
+		return err
+	}
+	if isSpecialFolder(f) {
+		return fmt.Errorf("can't rename special folder %q", f.Title())
+	}
+
+	d[keyTitle] = title
+	return p.reload()
+}
+
+// MoveItem moves a Folder or Bookmark to the end of Folder folder. If
+// folder is nil, the item is moved to the top level. The special
+// top-level folders cannot be moved, and a Folder cannot be moved into
+// itself, one of its descendants or the Reading List.
+//
+// A Bookmark moved into the Reading List is given Reading List metadata
+// with the current time as DateAdded, and one moved out of it loses its
+// metadata.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) MoveItem(it Item, folder *Folder) error {
+	d, from, err := p.findItem(it)
+	if err != nil {
+		return err
+	}
+	// folder may be from before an edit, so its Ancestors may be out of date
+	if folder != nil {
+		cur := p.FolderForUID(folder.UID())
+		if cur == nil {
+			return fmt.Errorf("%w: no folder with UID %s", ErrNotFound, folder.UID())
+		}
+		folder = cur
+	}
+
+	toRL := folder != nil && folder.IsReadingList()
+	if f, ok := it.(*Folder); ok {
+		if isSpecialFolder(f) {
+			return fmt.Errorf("can't move special folder %q", f.Title())
+		}
+		if toRL {
+			return fmt.Errorf("can't move folder %q into Reading List", f.Title())
+		}
+		if folder != nil {
+			if folder.UID() == f.UID() {
+				return fmt.Errorf("can't move folder %q into itself", f.Title())
+			}
+			for _, a := range folder.Ancestors {
+				if a.UID() == f.UID() {
+					return fmt.Errorf("can't move folder %q into its descendant %q", f.Title(), folder.Title())
+				}
+			}
+		}
+	}
+
+	to, err := p.childrenOf(folder)
+	if err != nil {
+		return err
+	}
+
+	if d[keyType] == WebBookmarkTypeLeaf {
+		if !toRL {
+			delete(d, keyReadingLst)
+		} else if _, ok := d[keyReadingLst]; !ok {
+			d[keyReadingLst] = map[string]interface{}{keyDateAdded: time.Now().UTC()}
+		}
+	}
+
+	from.remove(d)
+	to.set(append(to.get(), d))
+
+	return p.reload()
+}
+
+// DeleteItem removes a Folder or Bookmark. Deleting a Folder also deletes
+// its contents. The special top-level folders cannot be deleted.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) DeleteItem(it Item) error {
+	d, from, err := p.findItem(it)
+	if err != nil {
+		return err
+	}
+	if f, ok := it.(*Folder); ok && isSpecialFolder(f) {
+		return fmt.Errorf("can't delete special folder %q", f.Title())
+	}
+
+	from.remove(d)
+	return p.reload()
+}
+
+// MergeFolder copies the contents of Folder src into Folder target (or the
+// top level if target is nil). src need not belong to this Parser: it may
+// be created with NewFolder or read from another browser's bookmarks by
+// package importer.
+//
+// Sub-folders of src are merged with existing sub-folders of target that
+// have the same title, and Bookmarks whose URL is already present in the
+// destination folder are skipped. New items are given new UIDs. If target
+// is the Reading List, which cannot contain folders, the Bookmarks in
+// src's sub-folders are added directly to it.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) MergeFolder(target, src *Folder) error {
+	children, err := p.childrenOf(target)
+	if err != nil {
+		return err
+	}
+	rl := target != nil && target.IsReadingList()
+	if err := mergeEntries(children, src, rl); err != nil {
+		return err
+	}
+	return p.reload()
+}
+
+// mergeEntries recursively adds the contents of src to dst.
+func mergeEntries(dst childList, src *Folder, rl bool) error {
+	l := dst.get()
+
+	for _, f := range src.Folders {
+		if rl {
+			dst.set(l)
+			if err := mergeEntries(dst, f, rl); err != nil {
+				return err
+			}
+			l = dst.get()
+			continue
+		}
+		var d map[string]interface{}
+		for _, v := range l {
+			if m, ok := v.(map[string]interface{}); ok &&
+				m[keyType] == WebBookmarkTypeList && m[keyTitle] == f.Title() {
+				d = m
+				break
+			}
+		}
+		if d == nil {
+			uid, err := newUID()
+			if err != nil {
+				return err
+			}
+			d = newFolderEntry(uid, f.Title())
+			l = append(l, d)
+		}
+		if err := mergeEntries(childList{d}, f, rl); err != nil {
+			return err
+		}
+	}
+
+	seen := map[interface{}]bool{}
+	for _, v := range l {
+		if m, ok := v.(map[string]interface{}); ok && m[keyType] == WebBookmarkTypeLeaf {
+			seen[m[keyURL]] = true
+		}
+	}
+	for _, bm := range src.Bookmarks {
+		if seen[bm.URL] {
+			continue
+		}
+		uid, err := newUID()
+		if err != nil {
+			return err
+		}
+		l = append(l, newBookmarkEntry(uid, bm.Title(), bm.URL, rl))
+		seen[bm.URL] = true
+	}
+
+	dst.set(l)
+	return nil
+}
+
+// Save writes the bookmarks back to BookmarksPath in the same format
+// (binary or XML) that they were read in. The file is replaced atomically,
+// so a crash won't leave a half-written Bookmarks.plist.
+//
+// NOTE: Safari keeps its own copy of the bookmarks in memory and may
+// overwrite your changes if it is running.
+func (p *Parser) Save() error {
+	if p.data == nil {
+		return errors.New("no bookmarks loaded")
+	}
+
+	var indent string
+	if p.format == plist.XMLFormat {
+		indent = "\t"
+	}
+	data, err := plist.MarshalIndent(p.data, p.format, indent)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(p.BookmarksPath, data)
+}
+
+// reload rebuilds Folders and Bookmarks from the edited data.
+func (p *Parser) reload() error {
+	data, err := plist.Marshal(p.data, p.format)
+	if err != nil {
+		return err
+	}
+	return p.parseData(data)
+}
+
+// newFolderEntry returns the untyped data for a new folder.
+func newFolderEntry(uid, title string) map[string]interface{} {
+	return map[string]interface{}{
+		keyType:     WebBookmarkTypeList,
+		keyUUID:     uid,
+		keyTitle:    title,
+		keyChildren: []interface{}{},
+	}
+}
+
+// newBookmarkEntry returns the untyped data for a new bookmark. If
+// readingList is true, the entry is given Reading List metadata.
+func newBookmarkEntry(uid, title, URL string, readingList bool) map[string]interface{} {
+	d := map[string]interface{}{
+		keyType:    WebBookmarkTypeLeaf,
+		keyUUID:    uid,
+		keyURL:     URL,
+		keyURIDict: map[string]interface{}{"title": title},
+	}
+	if readingList {
+		d[keyReadingLst] = map[string]interface{}{keyDateAdded: time.Now().UTC()}
+	}
+	return d
+}
+
+// childList is a reference to the Children of an entry in the untyped data.
+type childList struct {
+	parent map[string]interface{}
+}
+
+// get returns the children.
+func (c childList) get() []interface{} {
+	l, _ := c.parent[keyChildren].([]interface{})
+	return l
+}
+
+// set replaces the children.
+func (c childList) set(l []interface{}) { c.parent[keyChildren] = l }
+
+// remove deletes entry d from the children.
+func (c childList) remove(d map[string]interface{}) {
+	var (
+		old = c.get()
+		l   = make([]interface{}, 0, len(old))
+	)
+	for _, v := range old {
+		if m, ok := v.(map[string]interface{}); ok && sameEntry(m, d) {
+			continue
+		}
+		l = append(l, v)
+	}
+	c.set(l)
+}
+
+// childrenOf returns the children of Folder f, or the top-level entries if f is nil.
+func (p *Parser) childrenOf(f *Folder) (childList, error) {
+	if p.data == nil {
+		return childList{}, errors.New("no bookmarks loaded")
+	}
+	if f == nil {
+		return childList{p.data}, nil
+	}
+
+	d, _, err := p.findItem(f)
+	if err != nil {
+		return childList{}, err
+	}
+	if d[keyType] != WebBookmarkTypeList {
+		return childList{}, fmt.Errorf("not a folder: %s", f.UID())
+	}
+	return childList{d}, nil
+}
+
+// findItem returns the untyped entry for an Item and the list that contains it.
+func (p *Parser) findItem(it Item) (map[string]interface{}, childList, error) {
+	if p.data == nil {
+		return nil, childList{}, errors.New("no bookmarks loaded")
+	}
+	// it may hold a nil *Bookmark or *Folder, e.g. from BookmarkForUID
+	switch v := it.(type) {
+	case nil:
+		return nil, childList{}, errors.New("no item")
+	case *Bookmark:
+		if v == nil {
+			return nil, childList{}, errors.New("no item")
+		}
+	case *Folder:
+		if v == nil {
+			return nil, childList{}, errors.New("no item")
+		}
+	}
+	if it.UID() == "" {
+		return nil, childList{}, errors.New("item has no UID")
+	}
+
+	d, parent := findEntry(p.data, it.UID())
+	if d == nil {
+		return nil, childList{}, fmt.Errorf("%w: no item with UID %s", ErrNotFound, it.UID())
+	}
+	return d, childList{parent}, nil
+}
+
+// findEntry recursively searches root for the entry with WebBookmarkUUID uid.
+// It returns the entry and its parent.
+func findEntry(root map[string]interface{}, uid string) (entry, parent map[string]interface{}) {
+	l, _ := root[keyChildren].([]interface{})
+	for _, v := range l {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if m[keyUUID] == uid {
+			return m, root
+		}
+		if entry, parent = findEntry(m, uid); entry != nil {
+			return entry, parent
+		}
+	}
+	return nil, nil
+}
+
+// sameEntry returns true if a and b are the same map.
+func sameEntry(a, b map[string]interface{}) bool {
+	return a[keyUUID] != nil && a[keyUUID] == b[keyUUID]
+}
+
+// isSpecialFolder returns true if f is the Bookmarks Bar, Bookmarks Menu or Reading List.
+func isSpecialFolder(f *Folder) bool {
+	return f.IsBookmarksBar() || f.IsBookmarksMenu() || f.IsReadingList()
+}
+
+// newUID generates a random (version 4) UUID in the uppercase form used by Safari.
+func newUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])), nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path, then renames it over path. The file mode of an existing file is
+// preserved.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op after successful rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,319 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-16
+//
+
+package safari
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+// writeTestBookmarks writes a Bookmarks.plist fixture in the given format to
+// a temporary directory and returns its path and a function to delete it.
+func writeTestBookmarks(t *testing.T, format int) (string, func()) {
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "Bookmarks.plist")
+	if err := fixtures.WriteBookmarks(path, format == plist.BinaryFormat); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return path, cleanup
+}
+
+// TestEditAndSave tests that edits are applied and survive a save.
+func TestEditAndSave(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work := p.FolderForUID("WORK")
+	f, err := p.AddFolder(work, "Projects")
+	if err != nil {
+		t.Fatalf("AddFolder: %v", err)
+	}
+	if len(f.Ancestors) != 2 || f.Ancestors[1].UID() != "WORK" {
+		t.Errorf("bad ancestors for new folder: %v", f.Ancestors)
+	}
+
+	bm, err := p.AddBookmark(f, "Go", "https://golang.org/")
+	if err != nil {
+		t.Fatalf("AddBookmark: %v", err)
+	}
+	if len(bm.UID()) != 36 {
+		t.Errorf("bad UID: %q", bm.UID())
+	}
+
+	if err := p.EditBookmark(p.BookmarkForUID("BM1"), "Example Site", "https://example.org/"); err != nil {
+		t.Fatalf("EditBookmark: %v", err)
+	}
+	if err := p.RenameFolder(work, "Office"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	if err := p.MoveItem(p.BookmarkForUID("BM2"), p.BookmarksMenu); err != nil {
+		t.Fatalf("MoveItem: %v", err)
+	}
+	if err := p.DeleteItem(p.BookmarkForUID("BM1")); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	format, err := plist.Unmarshal(data, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != plist.BinaryFormat {
+		t.Errorf("bad format. Expected=%v, Got=%v", plist.BinaryFormat, format)
+	}
+
+	p, err = New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.BookmarkForUID("BM1") != nil {
+		t.Error("deleted bookmark still present")
+	}
+	if f := p.FolderForUID("WORK"); f == nil || f.Title() != "Office" {
+		t.Errorf("folder not renamed: %v", f)
+	}
+	if bm := p.BookmarkForUID("BM2"); bm == nil || bm.Folder() != p.BookmarksMenu {
+		t.Errorf("bookmark not moved: %v", bm)
+	}
+	if bm := p.BookmarkForUID(bm.UID()); bm == nil || bm.Title() != "Go" || bm.Folder().Title() != "Projects" {
+		t.Errorf("bad new bookmark: %v", bm)
+	}
+}
+
+// TestEditPreservesUnknownKeys tests that keys unknown to rawBookmark are saved.
+func TestEditPreservesUnknownKeys(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.XMLFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.EditBookmark(p.BookmarkForUID("BM1"), "Example", "https://example.net/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.format != plist.XMLFormat {
+		t.Errorf("bad format. Expected=%v, Got=%v", plist.XMLFormat, p.format)
+	}
+	d, _ := findEntry(p.data, "BM1")
+	sync, _ := d["Sync"].(map[string]interface{})
+	if sync["Key"] != "preserve me" {
+		t.Errorf("unknown key lost: %#v", d)
+	}
+	if d[keyURL] != "https://example.net/" {
+		t.Errorf("bad URL: %v", d[keyURL])
+	}
+}
+
+// TestEditErrors tests that invalid edits are rejected.
+func TestEditErrors(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work := p.FolderForUID("WORK")
+	sub, err := p.AddFolder(work, "Sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"delete bar", func() error { return p.DeleteItem(p.BookmarksBar) }},
+		{"rename menu", func() error { return p.RenameFolder(p.BookmarksMenu, "x") }},
+		{"move reading list", func() error { return p.MoveItem(p.ReadingList, work) }},
+		{"move into self", func() error { return p.MoveItem(work, work) }},
+		{"move into child", func() error { return p.MoveItem(work, sub) }},
+		{"move into reading list", func() error { return p.MoveItem(sub, p.ReadingList) }},
+		{"add folder to reading list", func() error { _, err := p.AddFolder(p.ReadingList, "x"); return err }},
+		{"missing item", func() error { return p.DeleteItem(&Bookmark{uid: "NOPE"}) }},
+		{"nil item", func() error { return p.DeleteItem(nil) }},
+		{"nil bookmark", func() error { return p.EditBookmark(p.BookmarkForUID("NOPE"), "x", "y") }},
+		{"move nil bookmark", func() error { return p.MoveItem(p.BookmarkForUID("NOPE"), work) }},
+		{"delete nil folder", func() error { return p.DeleteItem(p.FolderForUID("NOPE")) }},
+		{"rename nil folder", func() error { return p.RenameFolder(p.FolderForUID("NOPE"), "x") }},
+		{"mark nil read", func() error { return p.MarkRead(p.BookmarkForUID("NOPE")) }},
+	}
+
+	for _, td := range tests {
+		if err := td.fn(); err == nil {
+			t.Errorf("%s: expected error", td.name)
+		}
+	}
+}
+
+// TestMoveStaleFolder tests that a Folder can't be moved into its
+// descendant when the destination Folder is from before an edit.
+func TestMoveStaleFolder(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := p.AddFolder(p.BookmarksMenu, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.AddFolder(p.BookmarksMenu, "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MoveItem(b, a); err != nil {
+		t.Fatalf("MoveItem: %v", err)
+	}
+	// b.Ancestors doesn't contain a
+	if err := p.MoveItem(a, b); err == nil {
+		t.Error("moved folder into its descendant")
+	}
+	if p.FolderForUID(a.UID()) == nil || p.FolderForUID(b.UID()) == nil {
+		t.Error("folders lost from tree")
+	}
+}
+
+// TestMoveReadingList tests that Reading List metadata is added to
+// bookmarks moved into the Reading List and removed from those moved out.
+func TestMoveReadingList(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.MoveItem(p.BookmarkForUID("BM2"), p.ReadingList); err != nil {
+		t.Fatalf("MoveItem: %v", err)
+	}
+	if err := p.MoveItem(p.BookmarkForUID("RL1"), p.BookmarksMenu); err != nil {
+		t.Fatalf("MoveItem: %v", err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	p, err = New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm := p.BookmarkForUID("BM2")
+	if !bm.InReadingList() {
+		t.Errorf("BM2 not in Reading List")
+	}
+	if bm.ReadingList == nil || bm.ReadingList.DateAdded.IsZero() {
+		t.Errorf("bad Reading List metadata for BM2: %+v", bm.ReadingList)
+	}
+	bm = p.BookmarkForUID("RL1")
+	if bm.InReadingList() {
+		t.Errorf("RL1 still in Reading List")
+	}
+	if bm.ReadingList != nil {
+		t.Errorf("RL1 has Reading List metadata: %+v", bm.ReadingList)
+	}
+}
+
+// TestMergeFolder tests that folders are merged and duplicates skipped.
+func TestMergeFolder(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewFolder("Imported", nil)
+	work := NewFolder("Work", src)
+	NewBookmark("Wiki", "https://wiki.example.com/", work)
+	NewBookmark("Docs", "https://docs.example.com/", work)
+	NewFolder("Empty", src)
+	NewBookmark("Example", "https://www.example.com/", src)
+
+	if err := p.MergeFolder(p.BookmarksBar, src); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(p.BookmarksBar.Bookmarks); n != 2 {
+		t.Errorf("bad no. of bookmarks in bar. Expected=2, Got=%d", n)
+	}
+	if n := len(p.BookmarksBar.Folders); n != 2 {
+		t.Errorf("bad no. of folders in bar. Expected=2, Got=%d", n)
+	}
+	f := p.FolderForUID("WORK")
+	if len(f.Bookmarks) != 2 || f.Bookmarks[1].URL != "https://docs.example.com/" {
+		t.Errorf("bad bookmarks in Work: %v", f.Bookmarks)
+	}
+}
+
+// TestMergeReadingList tests that folders merged into the Reading List
+// are flattened.
+func TestMergeReadingList(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewFolder("Imported", nil)
+	NewBookmark("Article", "https://news.example.com/1", src)
+	sub := NewFolder("Sub", src)
+	NewBookmark("Other", "https://news.example.com/2", sub)
+	NewBookmark("Old Post", "https://blog.example.com/old", sub)
+
+	if err := p.MergeFolder(p.ReadingList, src); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.ReadingList.Folders); n != 0 {
+		t.Errorf("bad no. of folders in Reading List. Expected=0, Got=%d", n)
+	}
+	if n := len(p.ReadingList.Bookmarks); n != 4 {
+		t.Errorf("bad no. of bookmarks in Reading List. Expected=4, Got=%d", n)
+	}
+	for _, bm := range p.ReadingList.Bookmarks {
+		if bm.ReadingList == nil {
+			t.Errorf("no Reading List metadata: %s", bm.URL)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-24
+//
+
+package safari
+
+import (
+	"errors"
+
+	"github.com/deanishe/go-safari/internal/errs"
+)
+
+// Errors returned by the package. Use errors.Is to check for them, as they
+// are usually wrapped. The history and cloud packages return the same values.
+var (
+	// A file, bookmark or folder doesn't exist.
+	ErrNotFound = errs.ErrNotFound
+	// The program lacks Full Disk Access (needed to read Safari's data
+	// files) or permission to automate Safari.
+	ErrPermissionDenied = errs.ErrPermissionDenied
+	// Safari isn't running, so it has no windows or tabs.
+	ErrSafariNotRunning = errs.ErrSafariNotRunning
+	// The specified window doesn't exist.
+	ErrNoSuchWindow = errs.ErrNoSuchWindow
+	// The specified tab doesn't exist.
+	ErrNoSuchTab = errs.ErrNoSuchTab
+	// Safari's "Allow JavaScript from Apple Events" setting is off, so
+	// JavaScript can't be run in tabs.
+	ErrJSDisabled = errs.ErrJSDisabled
+	// A database doesn't have the expected tables or columns, probably
+	// because it was created by an unsupported version of Safari.
+	ErrUnsupportedSchema = errs.ErrUnsupportedSchema
+	// Bookmark.ToJS was called on a Bookmark that isn't a bookmarklet.
+	ErrNotBookmarklet = errors.New("not a bookmarklet")
+	// A Worker's process exited before answering a request.
+	ErrWorkerDied = errors.New("worker process died")
+)
+
+// JSError is an exception thrown by JavaScript run in a tab by EvalJS.
+type JSError struct {
+	Name    string `json:"name"`    // e.g. "TypeError"
+	Message string `json:"message"` // Exception's message
+}
+
+// Error implements error.
+func (e *JSError) Error() string { return "JavaScript error: " + e.Name + ": " + e.Message }
@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-17
+//
+
+package safari
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Header of a Netscape bookmarks file.
+const netscapeHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`
+
+// ExportHTML writes the default Parser's bookmarks to w in Netscape Bookmark File format.
+func ExportHTML(w io.Writer) error {
+	p, err := defaultParser()
+	if err != nil {
+		return err
+	}
+	return p.ExportHTML(w)
+}
+
+// ExportHTML writes all bookmarks to w in Netscape Bookmark File
+// (NETSCAPE-Bookmark-file-1) format, which can be imported by all major
+// browsers.
+//
+// The Bookmarks Bar is exported as the toolbar folder. The Bookmarks Menu,
+// any other top-level folders and the Reading List are exported as normal
+// folders, followed by top-level bookmarks.
+func (p *Parser) ExportHTML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	e := &htmlExporter{w: bw}
+
+	e.printf("%s<DL><p>\n", netscapeHeader)
+
+	if p.BookmarksBar != nil {
+		e.folder(p.BookmarksBar, 1, ` PERSONAL_TOOLBAR_FOLDER="true"`)
+	}
+	if p.BookmarksMenu != nil {
+		e.folder(p.BookmarksMenu, 1, "")
+	}
+
+	// Other top-level folders
+	for _, f := range p.Folders {
+		if len(f.Ancestors) == 0 && !isSpecialFolder(f) {
+			e.folder(f, 1, "")
+		}
+	}
+
+	// Top-level bookmarks
+	for _, bm := range p.Bookmarks {
+		if len(bm.Ancestors) == 0 {
+			e.bookmark(bm, 1)
+		}
+	}
+
+	if p.ReadingList != nil {
+		e.folder(p.ReadingList, 1, "")
+	}
+
+	e.printf("</DL><p>\n")
+
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// ExportHTMLFile writes the default Parser's bookmarks to path in Netscape Bookmark File format.
+func ExportHTMLFile(path string) error {
+	p, err := defaultParser()
+	if err != nil {
+		return err
+	}
+	return p.ExportHTMLFile(path)
+}
+
+// ExportHTMLFile writes all bookmarks to path in the same format as
+// ExportHTML. The file is replaced atomically, so an existing file is left
+// untouched if the export fails.
+func (p *Parser) ExportHTMLFile(path string) error {
+	buf := &bytes.Buffer{}
+	if err := p.ExportHTML(buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// htmlExporter writes Folders and Bookmarks as Netscape HTML.
+// The first write error is saved in err and subsequent writes are ignored.
+type htmlExporter struct {
+	w   io.Writer
+	err error
+}
+
+// printf writes formatted output to the underlying Writer.
+func (e *htmlExporter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+// folder writes Folder f and its contents at the given indentation level.
+func (e *htmlExporter) folder(f *Folder, depth int, attrs string) {
+	indent := strings.Repeat("    ", depth)
+
+	e.printf("%s<DT><H3%s>%s</H3>\n", indent, attrs, html.EscapeString(f.Title()))
+	e.printf("%s<DL><p>\n", indent)
+	for _, f2 := range f.Folders {
+		e.folder(f2, depth+1, "")
+	}
+	for _, bm := range f.Bookmarks {
+		e.bookmark(bm, depth+1)
+	}
+	e.printf("%s</DL><p>\n", indent)
+}
+
+// bookmark writes Bookmark bm at the given indentation level.
+func (e *htmlExporter) bookmark(bm *Bookmark, depth int) {
+	e.printf("%s<DT><A HREF=\"%s\">%s</A>\n", strings.Repeat("    ", depth),
+		html.EscapeString(bm.URL), html.EscapeString(bm.Title()))
+}
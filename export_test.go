@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-17
+//
+
+package safari
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"howett.net/plist"
+)
+
+// TestExportHTML tests that bookmarks are exported as Netscape HTML.
+func TestExportHTML(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddBookmark(p.FolderForUID("WORK"), "Q&A <tips>", "https://example.com/?a=1&b=2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddBookmark(p.ReadingList, "Article", "https://news.example.com/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := p.ExportHTML(buf); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+
+	expected := []string{
+		"<!DOCTYPE NETSCAPE-Bookmark-file-1>",
+		`<DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Favorites</H3>`,
+		"        <DT><H3>Work</H3>",
+		`            <DT><A HREF="https://wiki.example.com/">Wiki</A>`,
+		`            <DT><A HREF="https://example.com/?a=1&amp;b=2">Q&amp;A &lt;tips&gt;</A>`,
+		"<DT><H3>Bookmarks Menu</H3>",
+		"<DT><H3>Reading List</H3>",
+		`<DT><A HREF="https://news.example.com/1">Article</A>`,
+	}
+	for _, x := range expected {
+		if !strings.Contains(s, x) {
+			t.Errorf("output does not contain %q", x)
+		}
+	}
+
+	if n, m := strings.Count(s, "<DL>"), strings.Count(s, "</DL>"); n != m {
+		t.Errorf("unbalanced <DL> tags: %d open, %d closed", n, m)
+	}
+}
+
+// TestExportHTMLFile tests that bookmarks are written to a file.
+func TestExportHTMLFile(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(filepath.Dir(path), "bookmarks.html")
+	if err := ioutil.WriteFile(out, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ExportHTMLFile(out); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := p.ExportHTML(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != buf.String() {
+		t.Errorf("bad file contents: %q", data)
+	}
+}
@@ -0,0 +1,486 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-20
+//
+
+package safari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// FakeTab is a tab in a FakeBackend.
+type FakeTab struct {
+	Title   string
+	URL     string
+	ID      string // Safari's ID for the tab. If empty, one is derived from URL and title.
+	Reloads int    // Number of times the tab has been reloaded
+
+	back, forward []string // history
+}
+
+// FakeWindow is a window in a FakeBackend.
+type FakeWindow struct {
+	Tabs    []*FakeTab
+	Current int  // 1-based index of current tab. 0 means the first tab.
+	ID      int  // Safari's ID for the window. Assigned by FakeBackend if 0.
+	Private bool // Whether window is a private window
+}
+
+// FakeBackend is an in-memory Backend for testing code that uses this
+// package's tab and window functions without Safari.
+//
+// It follows the same indexing rules as Safari: windows and tabs are
+// numbered from 1, window 1 is frontmost, activating a window moves it
+// to the front, and closing the last tab in a window closes the window.
+// Its methods return ctx.Err() if the Context is already cancelled.
+//
+// Wins may be read and modified directly, but not while the FakeBackend
+// is in use by other goroutines.
+type FakeBackend struct {
+	Wins []*FakeWindow // Frontmost window first
+
+	// JS is called by RunJS with the target tab and the script.
+	// If nil, RunJS does nothing.
+	JS func(tab *FakeTab, js string) error
+
+	// Eval is called by EvalJS with the target tab and the expression.
+	// Its result is serialised as JSON. If nil, EvalJS returns null.
+	Eval func(tab *FakeTab, js string) (interface{}, error)
+
+	mu     sync.Mutex
+	lastID int // last window ID assigned
+}
+
+// NewFakeBackend creates a FakeBackend with the specified windows, the first
+// of which is frontmost.
+func NewFakeBackend(wins ...*FakeWindow) *FakeBackend {
+	return &FakeBackend{Wins: wins}
+}
+
+// Windows implements Backend.
+func (fb *FakeBackend) Windows(ctx context.Context) ([]*Window, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	wins := []*Window{}
+	for i, fw := range fb.Wins {
+		w := &Window{Index: i + 1, ActiveTab: fw.current(), Tabs: []*Tab{}, ID: fb.windowID(fw)}
+		for j := range fw.Tabs {
+			w.Tabs = append(w.Tabs, fb.tab(i+1, j+1))
+		}
+		wins = append(wins, w)
+	}
+	return wins, nil
+}
+
+// ActiveTab implements Backend.
+func (fb *FakeBackend) ActiveTab(ctx context.Context) (*Tab, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if len(fb.Wins) == 0 || fb.Wins[0].current() == 0 {
+		return nil, fmt.Errorf("%w: no windows", ErrNoSuchWindow)
+	}
+	return fb.tab(1, fb.Wins[0].current()), nil
+}
+
+// Activate implements Backend.
+func (fb *FakeBackend) Activate(ctx context.Context, win, tab int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fw, err := fb.window(win)
+	if err != nil {
+		return err
+	}
+	if tab > 0 {
+		if _, err := fb.lookup(win, tab); err != nil {
+			return err
+		}
+		fw.Current = tab
+	}
+
+	fb.raise(win)
+	return nil
+}
+
+// Open implements Backend. New tabs have no title.
+func (fb *FakeBackend) Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	ft := &FakeTab{URL: URL}
+	if opts.NewWindow || opts.Private || len(fb.Wins) == 0 {
+		fw := &FakeWindow{Tabs: []*FakeTab{ft}, Private: opts.Private}
+		fb.Wins = append([]*FakeWindow{fw}, fb.Wins...)
+		return fb.tab(1, 1), nil
+	}
+
+	fw, err := fb.window(opts.Window)
+	if err != nil {
+		return nil, err
+	}
+	fw.Tabs = append(fw.Tabs, ft)
+	win, tab := opts.Window, len(fw.Tabs)
+	if !opts.Background {
+		fw.Current = tab
+		fb.raise(win)
+		win = 1
+	}
+	return fb.tab(win, tab), nil
+}
+
+// Close implements Backend.
+func (fb *FakeBackend) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fw, err := fb.window(win)
+	if err != nil {
+		return err
+	}
+
+	if what == TargetWin {
+		fb.Wins = append(fb.Wins[:win-1], fb.Wins[win:]...)
+		return nil
+	}
+
+	if tab == 0 {
+		tab = fw.current()
+	}
+	if _, err := fb.lookup(win, tab); err != nil {
+		return err
+	}
+
+	var closeTab func(i int) bool
+	switch what {
+	case TargetTab:
+		closeTab = func(i int) bool { return i == tab }
+	case TargetTabsOther:
+		closeTab = func(i int) bool { return i != tab }
+	case TargetTabsLeft:
+		closeTab = func(i int) bool { return i < tab }
+	case TargetTabsRight:
+		closeTab = func(i int) bool { return i > tab }
+	default:
+		return fmt.Errorf("invalid target: %s", what)
+	}
+
+	var (
+		current = fw.Tabs[fw.current()-1]
+		target  = fw.Tabs[tab-1]
+		tabs    []*FakeTab
+	)
+	for i, t := range fw.Tabs {
+		if !closeTab(i + 1) {
+			tabs = append(tabs, t)
+		}
+	}
+	fw.Tabs = tabs
+
+	if len(tabs) == 0 {
+		fb.Wins = append(fb.Wins[:win-1], fb.Wins[win:]...)
+		return nil
+	}
+
+	// Keep current tab if it's still open, else select the target tab
+	// or the tab that took its place.
+	fw.Current = 0
+	for i, t := range tabs {
+		if t == current {
+			fw.Current = i + 1
+			break
+		}
+		if t == target {
+			fw.Current = i + 1
+		}
+	}
+	if fw.Current == 0 {
+		fw.Current = tab
+		if fw.Current > len(tabs) {
+			fw.Current = len(tabs)
+		}
+	}
+	return nil
+}
+
+// Move implements Backend. Moving a window's last tab out of it closes
+// the window. If the current tab is moved out of a window, the tab that
+// took its place becomes current.
+func (fb *FakeBackend) Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	ft, err := fb.lookup(win, tab)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		src     = fb.Wins[win-1]
+		current = src.Tabs[src.current()-1]
+		dst     *FakeWindow
+	)
+	if toWin != 0 {
+		if dst, err = fb.window(toWin); err != nil {
+			return nil, err
+		}
+	}
+
+	src.Tabs = append(src.Tabs[:tab-1:tab-1], src.Tabs[tab:]...)
+	if dst == nil {
+		dst = &FakeWindow{Tabs: []*FakeTab{ft}, Private: src.Private}
+		fb.Wins = append([]*FakeWindow{dst}, fb.Wins...)
+	} else {
+		var dstCurrent *FakeTab
+		if dst.current() > 0 {
+			dstCurrent = dst.Tabs[dst.current()-1]
+		}
+		if src == dst {
+			dstCurrent = current
+		}
+		i := toTab - 1
+		if i < 0 || i > len(dst.Tabs) {
+			i = len(dst.Tabs)
+		}
+		dst.Tabs = append(dst.Tabs[:i:i], append([]*FakeTab{ft}, dst.Tabs[i:]...)...)
+		dst.Current = tabIndex(dst.Tabs, dstCurrent)
+	}
+
+	if src != dst {
+		switch {
+		case len(src.Tabs) == 0:
+			i := fb.windowIndex(src)
+			fb.Wins = append(fb.Wins[:i-1], fb.Wins[i:]...)
+		case current == ft:
+			src.Current = tab
+			if src.Current > len(src.Tabs) {
+				src.Current = len(src.Tabs)
+			}
+		default:
+			src.Current = tabIndex(src.Tabs, current)
+		}
+	}
+
+	return fb.tab(fb.windowIndex(dst), tabIndex(dst.Tabs, ft)), nil
+}
+
+// Reorder implements Backend.
+func (fb *FakeBackend) Reorder(ctx context.Context, win int, order []int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fw, err := fb.window(win)
+	if err != nil {
+		return err
+	}
+	if len(order) != len(fw.Tabs) {
+		return fmt.Errorf("%w: %d tabs in new order, window %d has %d", ErrNoSuchTab, len(order), win, len(fw.Tabs))
+	}
+
+	var (
+		tabs = make([]*FakeTab, len(order))
+		seen = map[int]bool{}
+	)
+	for i, j := range order {
+		if j < 1 || j > len(fw.Tabs) || seen[j] {
+			return fmt.Errorf("%w: %d in new order of window %d", ErrNoSuchTab, j, win)
+		}
+		seen[j] = true
+		tabs[i] = fw.Tabs[j-1]
+	}
+
+	if fw.current() > 0 {
+		current := fw.Tabs[fw.current()-1]
+		fw.Tabs = tabs
+		fw.Current = tabIndex(tabs, current)
+	}
+	return nil
+}
+
+// RunJS implements Backend.
+func (fb *FakeBackend) RunJS(ctx context.Context, win, tab int, js string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	ft, err := fb.lookup(win, tab)
+	fb.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if fb.JS == nil {
+		return nil
+	}
+	return fb.JS(ft, js)
+}
+
+// Navigate implements Backend. NavGo sets the tab's URL and clears its
+// title, and NavBack and NavForward move through the URLs it has been
+// navigated to. NavStop does nothing.
+func (fb *FakeBackend) Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	ft, err := fb.lookup(win, tab)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case NavGo:
+		ft.back, ft.forward = append(ft.back, ft.URL), nil
+		ft.URL, ft.Title = URL, ""
+	case NavReload:
+		ft.Reloads++
+	case NavBack:
+		if n := len(ft.back); n > 0 {
+			ft.forward = append(ft.forward, ft.URL)
+			ft.URL, ft.Title, ft.back = ft.back[n-1], "", ft.back[:n-1]
+		}
+	case NavForward:
+		if n := len(ft.forward); n > 0 {
+			ft.back = append(ft.back, ft.URL)
+			ft.URL, ft.Title, ft.forward = ft.forward[n-1], "", ft.forward[:n-1]
+		}
+	case NavStop:
+	default:
+		return fmt.Errorf("invalid action: %s", action)
+	}
+	return nil
+}
+
+// EvalJS implements Backend.
+func (fb *FakeBackend) EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fb.mu.Lock()
+	ft, err := fb.lookup(win, tab)
+	fb.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if fb.Eval == nil {
+		return []byte("null"), nil
+	}
+	v, err := fb.Eval(ft, js)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// raise brings window win to the front.
+func (fb *FakeBackend) raise(win int) {
+	fw := fb.Wins[win-1]
+	fb.Wins = append(fb.Wins[:win-1], fb.Wins[win:]...)
+	fb.Wins = append([]*FakeWindow{fw}, fb.Wins...)
+}
+
+// window returns the FakeWindow with 1-based index win.
+func (fb *FakeBackend) window(win int) (*FakeWindow, error) {
+	if win < 1 || win > len(fb.Wins) {
+		return nil, fmt.Errorf("%w: %d", ErrNoSuchWindow, win)
+	}
+	return fb.Wins[win-1], nil
+}
+
+// lookup returns the FakeTab with 1-based indices win and tab.
+func (fb *FakeBackend) lookup(win, tab int) (*FakeTab, error) {
+	fw, err := fb.window(win)
+	if err != nil {
+		return nil, err
+	}
+	if tab < 1 || tab > len(fw.Tabs) {
+		return nil, fmt.Errorf("%w: %d in window %d", ErrNoSuchTab, tab, win)
+	}
+	return fw.Tabs[tab-1], nil
+}
+
+// tab returns a Tab for the FakeTab at the given indices.
+func (fb *FakeBackend) tab(win, tab int) *Tab {
+	fw := fb.Wins[win-1]
+	ft := fw.Tabs[tab-1]
+	return &Tab{
+		Index:       tab,
+		WindowIndex: win,
+		Title:       ft.Title,
+		URL:         ft.URL,
+		Active:      tab == fw.current(),
+		ID:          ft.ID,
+		WindowID:    fb.windowID(fw),
+	}
+}
+
+// windowID returns fw's ID, assigning it one if it doesn't have one.
+// IDs are unique unless the caller sets IDs that FakeBackend also assigns.
+func (fb *FakeBackend) windowID(fw *FakeWindow) int {
+	if fw.ID == 0 {
+		fb.lastID++
+		fw.ID = fb.lastID
+	}
+	return fw.ID
+}
+
+// tabIndex returns the 1-based index of t in tabs, or 0 if it isn't present.
+func tabIndex(tabs []*FakeTab, t *FakeTab) int {
+	for i, t2 := range tabs {
+		if t2 == t {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// windowIndex returns the 1-based index of fw, or 0 if it isn't present.
+func (fb *FakeBackend) windowIndex(fw *FakeWindow) int {
+	for i, w := range fb.Wins {
+		if w == fw {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// current returns the valid 1-based index of the window's current tab,
+// or 0 if the window has no tabs.
+func (fw *FakeWindow) current() int {
+	if len(fw.Tabs) == 0 {
+		return 0
+	}
+	if fw.Current < 1 || fw.Current > len(fw.Tabs) {
+		return 1
+	}
+	return fw.Current
+}
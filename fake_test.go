@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-20
+//
+
+package safari
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newTestBackend returns a FakeBackend with 2 windows, containing tabs
+// "a"-"e" and "x"-"y", and sets it as the package's Backend. Call the
+// returned function to restore the previous Backend.
+func newTestBackend() (*FakeBackend, func()) {
+	fb := NewFakeBackend(
+		&FakeWindow{Current: 2, Tabs: fakeTabs("a", "b", "c", "d", "e")},
+		&FakeWindow{Tabs: fakeTabs("x", "y")},
+	)
+	prev := backend
+	SetBackend(fb)
+	return fb, func() { SetBackend(prev) }
+}
+
+// fakeTabs creates a FakeTab for each title.
+func fakeTabs(titles ...string) []*FakeTab {
+	tabs := []*FakeTab{}
+	for _, s := range titles {
+		tabs = append(tabs, &FakeTab{Title: s, URL: "https://" + s + ".example.com/"})
+	}
+	return tabs
+}
+
+// layout returns a string representation of the windows and tabs,
+// e.g. "a *b c|x y", where * marks the current tab.
+func layout(t *testing.T) string {
+	wins, err := Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s []string
+	for _, w := range wins {
+		var tabs []string
+		for _, tab := range w.Tabs {
+			if tab.WindowIndex != w.Index {
+				t.Errorf("bad WindowIndex. Expected=%d, Got=%d", w.Index, tab.WindowIndex)
+			}
+			if tab.Active {
+				tabs = append(tabs, "*"+tab.Title)
+			} else {
+				tabs = append(tabs, tab.Title)
+			}
+		}
+		s = append(s, strings.Join(tabs, " "))
+	}
+	return strings.Join(s, "|")
+}
+
+func TestFakeBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func() error
+		x    string
+	}{
+		{"initial", func() error { return nil }, "a *b c d e|*x y"},
+		{"activate tab", func() error { return ActivateTab(1, 4) }, "a b c *d e|*x y"},
+		{"activate win", func() error { return ActivateWin(2) }, "*x y|a *b c d e"},
+		{"activate both", func() error { return Activate(2, 2) }, "x *y|a *b c d e"},
+		{"close tab", func() error { return CloseTab(1, 1) }, "*b c d e|*x y"},
+		{"close current", func() error { return Close(0, 0) }, "a *c d e|*x y"},
+		{"close left", func() error { return CloseTabsLeft(1, 3) }, "*c d e|*x y"},
+		{"close right", func() error { return CloseTabsRight(1, 3) }, "a *b c|*x y"},
+		{"close other", func() error { return CloseTabsOther(1, 4) }, "*d|*x y"},
+		{"close win", func() error { return CloseWin(1) }, "*x y"},
+		{"close last tabs", func() error {
+			if err := CloseTab(2, 1); err != nil {
+				return err
+			}
+			return CloseTab(2, 0)
+		}, "a *b c d e"},
+	}
+
+	for _, td := range tests {
+		_, restore := newTestBackend()
+		if err := td.fn(); err != nil {
+			t.Errorf("%s: %v", td.name, err)
+		} else if s := layout(t); s != td.x {
+			t.Errorf("%s: Expected=%q, Got=%q", td.name, td.x, s)
+		}
+		restore()
+	}
+}
+
+func TestFakeBackendTabs(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+
+	tab, err := ActiveTab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.Title != "b" || tab.Index != 2 || tab.WindowIndex != 1 || !tab.Active {
+		t.Errorf("bad active tab: %#v", tab)
+	}
+
+	var ran []string
+	fb.JS = func(ft *FakeTab, js string) error {
+		ran = append(ran, ft.Title+":"+js)
+		return nil
+	}
+	wins, err := Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wins[1].Tabs[1].RunJS("alert(1)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != "y:alert(1)" {
+		t.Errorf("bad JS calls: %v", ran)
+	}
+
+	if err := wins[0].Tabs[2].Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "a b *c d e|*x y" {
+		t.Errorf("tab not activated: %s", s)
+	}
+
+	for _, td := range []struct {
+		fn func() error
+		x  error
+	}{
+		{func() error { return Activate(3, 0) }, ErrNoSuchWindow},
+		{func() error { return ActivateTab(1, 6) }, ErrNoSuchTab},
+		{func() error { return CloseTab(2, 3) }, ErrNoSuchTab},
+		{func() error { return (&Tab{WindowIndex: 1, Index: 9}).RunJS("") }, ErrNoSuchTab},
+	} {
+		if err := td.fn(); !errors.Is(err, td.x) {
+			t.Errorf("Expected=%v, Got=%v", td.x, err)
+		}
+	}
+
+	fb.JS = func(*FakeTab, string) error { return fmt.Errorf("boom") }
+	if err := wins[0].Tabs[0].RunJS(""); err == nil {
+		t.Error("JS error not returned")
+	}
+}
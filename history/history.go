@@ -12,19 +12,23 @@
 // accesses Safari's private SQLite database.
 //
 // The package-level functions call methods on the default History,
-// which is initialised with the default Safari history database.
+// which is opened from the default Safari history database the first
+// time it's needed. Importing the package has no side effects.
 package history
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	// sqlite3 registers itself with sql
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/deanishe/go-safari/internal/errs"
 )
 
 var (
@@ -32,24 +36,71 @@ var (
 	DefaultHistoryPath = filepath.Join(os.Getenv("HOME"), "Library/Safari/History.db")
 	// MaxSearchResults is the number of results to return from a search.
 	MaxSearchResults = 200
-	history          *History
 	// NSDate epoch starts at 00:00:00 on 1/1/2001 UTC
 	tsOffset = 978307200.0
+
+	// Default History, opened on first successful use
+	history   *History
+	historyMu sync.Mutex
 )
 
-func init() {
-	var err error
-	history, err = New(DefaultHistoryPath)
-	if err != nil {
-		panic(err)
+// Errors returned by the package. They are the same values as those
+// returned by package safari. Use errors.Is to check for them.
+var (
+	ErrNotFound          = errs.ErrNotFound
+	ErrPermissionDenied  = errs.ErrPermissionDenied
+	ErrUnsupportedSchema = errs.ErrUnsupportedSchema
+)
+
+// ErrStop can be returned by the function passed to Each to stop
+// iteration. Each does not return it.
+var ErrStop = errors.New("stop iteration")
+
+// OpenError is returned when a history database can't be opened.
+type OpenError = errs.OpenError
+
+// Default returns the default History, which reads DefaultHistoryPath.
+// The database is opened on the first successful call, and the same
+// History is returned by subsequent calls. If it can't be opened, e.g.
+// because the program doesn't have Full Disk Access yet, the next call
+// tries again.
+func Default() (*History, error) {
+	return defaultContext(context.Background())
+}
+
+// defaultContext is like Default, but the database is opened with ctx.
+func defaultContext(ctx context.Context) (*History, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if history == nil {
+		h, err := NewContext(ctx, DefaultHistoryPath)
+		if err != nil {
+			return nil, err
+		}
+		history = h
 	}
+	return history, nil
 }
 
-// Entry is a History entry.
+// Entry is a History entry. Normally, each Entry is a single visit, and
+// FirstVisit and LastVisit are both the same as Time. Entries returned by
+// RecentUnique, SearchUnique, SearchRanked or a Query with Unique set
+// aggregate all matching visits to a URL.
 type Entry struct {
 	Title string
 	URL   string
-	Time  time.Time
+	Time  time.Time // Time of visit (most recent visit if aggregated)
+
+	VisitCount int       // Number of matching visits (Safari's total if not aggregated)
+	FirstVisit time.Time // Time of earliest matching visit
+	LastVisit  time.Time // Time of most recent matching visit
+
+	VisitID        int64  // ID of visit. 0 if entry aggregates several visits.
+	RedirectedFrom string // URL of the visit that redirected to this one, if any
+	RedirectedTo   string // URL this visit redirected to, if any
+
+	Score float64 // Relevance of entry. Only set by SearchRanked.
 }
 
 // History is a Safari history.
@@ -58,10 +109,25 @@ type History struct {
 }
 
 // New creates a new History from a Safari history database.
+// It returns an *OpenError if the database can't be opened.
 func New(filename string) (*History, error) {
-	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&cache=shared&_timeout=9999999&_journal=WAL", filename))
+	return NewContext(context.Background(), filename)
+}
+
+// NewContext is like New, but aborts if ctx is cancelled while the
+// database is being opened.
+func NewContext(ctx context.Context, filename string) (*History, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, &OpenError{Path: filename, Err: errs.File(err)}
+	}
+	registerDriver()
+	db, err := sql.Open(driverName, fmt.Sprintf("file:%s?mode=ro&cache=shared&_timeout=9999999&_journal=WAL", filename))
 	if err != nil {
-		return nil, fmt.Errorf("couldn't open database %s: %s", filename, err)
+		return nil, &OpenError{Path: filename, Err: err}
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, &OpenError{Path: filename, Err: errs.SQL(err)}
 	}
 	return &History{db}, nil
 }
@@ -69,18 +135,56 @@ func New(filename string) (*History, error) {
 // Recent returns the specified number of most recent items from History.
 // Entries without a title or with a non-HTTP* scheme are ignored.
 //
-// NOTE: The results will often contain many duplicates.
-func Recent(count int) ([]*Entry, error) { return history.Recent(count) }
+// NOTE: The results will often contain many duplicates. Use RecentUnique
+// to get one Entry per URL.
+func Recent(count int) ([]*Entry, error) {
+	return RecentContext(context.Background(), count)
+}
+
+// RecentContext is like Recent, but aborts if ctx is cancelled.
+func RecentContext(ctx context.Context, count int) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.RecentContext(ctx, count)
+}
+
+// Recent returns the specified number of most recent items from History.
 func (h *History) Recent(count int) ([]*Entry, error) {
-	q := `
-	SELECT url, visit_time, title
-		FROM history_items
-			LEFT JOIN history_visits
-				ON history_visits.history_item = history_items.id
-		WHERE title <> '' AND url LIKE 'http%'
-		ORDER BY visit_time DESC LIMIT ?`
+	return h.RecentContext(context.Background(), count)
+}
+
+// RecentContext is like Recent, but aborts if ctx is cancelled.
+func (h *History) RecentContext(ctx context.Context, count int) ([]*Entry, error) {
+	return h.find(ctx, Query{Limit: count}, nil)
+}
+
+// RecentUnique returns the specified number of most recently-visited URLs
+// from History, one Entry per URL. Entries without a title or with a
+// non-HTTP* scheme are ignored.
+func RecentUnique(count int) ([]*Entry, error) {
+	return RecentUniqueContext(context.Background(), count)
+}
+
+// RecentUniqueContext is like RecentUnique, but aborts if ctx is cancelled.
+func RecentUniqueContext(ctx context.Context, count int) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.RecentUniqueContext(ctx, count)
+}
+
+// RecentUnique returns the specified number of most recently-visited URLs,
+// one Entry per URL.
+func (h *History) RecentUnique(count int) ([]*Entry, error) {
+	return h.RecentUniqueContext(context.Background(), count)
+}
 
-	return h.query(q, count)
+// RecentUniqueContext is like RecentUnique, but aborts if ctx is cancelled.
+func (h *History) RecentUniqueContext(ctx context.Context, count int) ([]*Entry, error) {
+	return h.find(ctx, Query{Limit: count, Unique: true}, nil)
 }
 
 // Search searches all History entries.
@@ -90,55 +194,132 @@ func (h *History) Recent(count int) ([]*Entry, error) {
 //
 //     AND title LIKE %word1% AND title LIKE %word2% etc.
 //
-func Search(query string) ([]*Entry, error) { return history.Search(query) }
+func Search(query string) ([]*Entry, error) {
+	return SearchContext(context.Background(), query)
+}
+
+// SearchContext is like Search, but aborts if ctx is cancelled.
+func SearchContext(ctx context.Context, query string) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.SearchContext(ctx, query)
+}
+
+// Search searches all History entries.
 func (h *History) Search(query string) ([]*Entry, error) {
-	var (
-		args []interface{}
-		// Start of SQL query
-		q = `
-	SELECT url, visit_time, title
-		FROM history_items
-			LEFT JOIN history_visits
-				ON history_visits.history_item = history_items.id
-		WHERE title <> '' AND url LIKE 'http%'`
-	)
-
-	// Add condition and placeholder for each search term
-	for _, s := range strings.Fields(query) {
-		args = append(args, "%"+s+"%")
-		q = q + ` AND title LIKE ?`
+	return h.SearchContext(context.Background(), query)
+}
+
+// SearchContext is like Search, but aborts if ctx is cancelled.
+func (h *History) SearchContext(ctx context.Context, query string) ([]*Entry, error) {
+	return h.find(ctx, Query{Limit: MaxSearchResults}, strings.Fields(query))
+}
+
+// SearchUnique searches all History entries like Search, but returns one
+// Entry per URL, ordered by the most recent matching visit.
+func SearchUnique(query string) ([]*Entry, error) {
+	return SearchUniqueContext(context.Background(), query)
+}
+
+// SearchUniqueContext is like SearchUnique, but aborts if ctx is cancelled.
+func SearchUniqueContext(ctx context.Context, query string) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.SearchUniqueContext(ctx, query)
+}
+
+// SearchUnique searches all History entries, returning one Entry per URL.
+func (h *History) SearchUnique(query string) ([]*Entry, error) {
+	return h.SearchUniqueContext(context.Background(), query)
+}
+
+// SearchUniqueContext is like SearchUnique, but aborts if ctx is cancelled.
+func (h *History) SearchUniqueContext(ctx context.Context, query string) ([]*Entry, error) {
+	return h.find(ctx, Query{Limit: MaxSearchResults, Unique: true}, strings.Fields(query))
+}
+
+// query runs an SQL query against the database and returns all the
+// Entries. The query must select the columns scanned by each.
+func (h *History) query(ctx context.Context, q string, args ...interface{}) ([]*Entry, error) {
+	var entries []*Entry
+	err := h.each(ctx, q, args, func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return entries, nil
+}
 
-	// Finish query
-	q = q + `
-		ORDER BY visit_time DESC LIMIT ?
-		`
-
-	args = append(args, MaxSearchResults)
-	return h.query(q, args...)
-}
-
-// query runs an SQL query against the database.
-func (h *History) query(q string, args ...interface{}) ([]*Entry, error) {
-	var (
-		url, title string
-		when       float64
-		ts         int64
-		t          time.Time
-		entries    []*Entry
-	)
-	rows, err := h.DB.Query(q, args...)
+// each runs an SQL query against the database and calls fn for each row.
+// The query must select url, visit time, title, visit count, first visit
+// time, visit ID and the URLs the visit was redirected from and to. If it
+// selects another column, that is read into the entries' Score.
+// NULL titles and URLs are converted to "", and NULL times to zero times.
+func (h *History) each(ctx context.Context, q string, args []interface{}, fn func(*Entry) error) error {
+	rows, err := h.DB.QueryContext(ctx, q, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error running query:%s with args: %+v\nerror: %s", q, args, err)
+		return fmt.Errorf("error running query:%s with args: %+v\nerror: %w", q, args, errs.SQL(err))
 	}
 	defer rows.Close()
 
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("error reading columns: %w", errs.SQL(err))
+	}
+
 	for rows.Next() {
-		rows.Scan(&url, &when, &title)
-		ts = int64(when + tsOffset)
-		t = time.Unix(ts, 0).Local()
-		entries = append(entries, &Entry{title, url, t})
+		var (
+			url, title, from, to sql.NullString
+			when, first, score   sql.NullFloat64
+			count, id            sql.NullInt64
+			dest                 = []interface{}{&url, &when, &title, &count, &first, &id, &from, &to}
+		)
+		if len(cols) > len(dest) {
+			dest = append(dest, &score)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("error reading row: %w", errs.SQL(err))
+		}
+		t := fromNullNSDate(when)
+		e := &Entry{
+			Title:          title.String,
+			URL:            url.String,
+			Time:           t,
+			VisitCount:     int(count.Int64),
+			FirstVisit:     fromNullNSDate(first),
+			LastVisit:      t,
+			VisitID:        id.Int64,
+			RedirectedFrom: from.String,
+			RedirectedTo:   to.String,
+			Score:          score.Float64,
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading rows: %w", errs.SQL(err))
+	}
+	return nil
+}
+
+// fromNullNSDate converts a nullable NSDate to a local time. NULL is
+// converted to the zero time.
+func fromNullNSDate(ts sql.NullFloat64) time.Time {
+	if !ts.Valid {
+		return time.Time{}
 	}
+	return fromNSDate(ts.Float64)
+}
 
-	return entries, nil
+// fromNSDate converts seconds since the NSDate epoch to a local time.
+func fromNSDate(ts float64) time.Time {
+	sec := math.Floor(ts)
+	return time.Unix(int64(sec+tsOffset), int64(math.Round((ts-sec)*1e9))).Local()
 }
@@ -9,16 +9,33 @@
 package history
 
 import (
+	"context"
+	"errors"
 	"net/url"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
 )
 
-func TestRecent(t *testing.T) {
-	h, err := New(DefaultHistoryPath)
+// testHistory returns a History for the History.db fixture.
+func testHistory(t *testing.T) (*History, func()) {
+	dir, cleanup := fixtures.Dir(t)
+	h, err := New(filepath.Join(dir, fixtures.HistoryFile))
 	if err != nil {
+		cleanup()
 		t.Fatal(err)
 	}
+	return h, func() {
+		h.DB.Close()
+		cleanup()
+	}
+}
+
+func TestRecent(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
 
 	entries, err := h.Recent(10)
 	if err != nil {
@@ -36,6 +53,9 @@ func TestRecent(t *testing.T) {
 		if e.Time.After(time.Now()) {
 			t.Errorf("entry %d in future: %#v", i, e)
 		}
+		if i > 0 && e.Time.After(entries[i-1].Time) {
+			t.Errorf("entry %d newer than entry %d", i, i-1)
+		}
 		u, err := url.Parse(e.URL)
 		if err != nil {
 			t.Errorf("entry %d has bad URL: %v", i, err)
@@ -45,25 +65,187 @@ func TestRecent(t *testing.T) {
 			t.Errorf("entry %d has bad scheme: %s", i, u.Scheme)
 		}
 	}
+
+	if !entries[0].Time.Equal(fixtures.HistoryTime) {
+		t.Errorf("bad time. Expected=%v, Got=%v", fixtures.HistoryTime, entries[0].Time)
+	}
+	if entries[0].URL != "https://www.google.com/" || entries[0].Title != "Google" {
+		t.Errorf("bad first entry: %#v", entries[0])
+	}
 }
 
-var testQueries = []string{"google", "alfred"}
+func TestRecentUnique(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
 
-func TestSearch(t *testing.T) {
-	h, err := New(DefaultHistoryPath)
+	entries, err := h.RecentUnique(100)
 	if err != nil {
 		t.Fatal(err)
 	}
-	for _, q := range testQueries {
-		entries, err := h.Search(q)
+	if len(entries) != 8 {
+		t.Fatalf("bad no. of entries. Expected=8, Got=%d", len(entries))
+	}
+
+	seen := map[string]bool{}
+	for i, e := range entries {
+		if seen[e.URL] {
+			t.Errorf("entry %d is a duplicate: %s", i, e.URL)
+		}
+		seen[e.URL] = true
+		if i > 0 && e.Time.After(entries[i-1].Time) {
+			t.Errorf("entry %d newer than entry %d", i, i-1)
+		}
+		if !e.Time.Equal(e.LastVisit) {
+			t.Errorf("entry %d: Time != LastVisit: %v, %v", i, e.Time, e.LastVisit)
+		}
+		if e.FirstVisit.After(e.LastVisit) {
+			t.Errorf("entry %d: FirstVisit after LastVisit: %v, %v", i, e.FirstVisit, e.LastVisit)
+		}
+	}
+
+	e := entries[0]
+	if e.URL != "https://www.google.com/" || e.Title != "Google" {
+		t.Errorf("bad first entry: %#v", e)
+	}
+	if e.VisitCount != 5 {
+		t.Errorf("bad visit count. Expected=5, Got=%d", e.VisitCount)
+	}
+	first := fixtures.HistoryTime.Add(-400 * time.Hour)
+	if !e.FirstVisit.Equal(first) {
+		t.Errorf("bad first visit. Expected=%v, Got=%v", first, e.FirstVisit)
+	}
+	if !e.LastVisit.Equal(fixtures.HistoryTime) {
+		t.Errorf("bad last visit. Expected=%v, Got=%v", fixtures.HistoryTime, e.LastVisit)
+	}
+}
+
+var testQueries = []struct {
+	q string
+	n int
+}{
+	{"google", 6},
+	{"alfred", 3},
+	{"GOOGLE search", 1},
+	{"wiki", 6},
+	{"files", 0},
+}
+
+func TestSearch(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	for _, td := range testQueries {
+		entries, err := h.Search(td.q)
 		if err != nil {
-			t.Errorf("search for '%s' failed: %v", q, err)
+			t.Errorf("search for '%s' failed: %v", td.q, err)
 		}
-		if len(entries) == 0 {
-			t.Errorf("no results for '%s'", q)
+		if len(entries) != td.n {
+			t.Errorf("bad no. of results for '%s'. Expected=%d, Got=%d", td.q, td.n, len(entries))
 		}
 		if len(entries) > MaxSearchResults {
-			t.Errorf("too many results for '%s': %d", q, len(entries))
+			t.Errorf("too many results for '%s': %d", td.q, len(entries))
+		}
+	}
+}
+
+func TestSearchUnique(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	tests := []struct {
+		q string
+		n int
+	}{
+		{"google", 2},
+		{"alfred", 1},
+		{"wiki", 2},
+		{"files", 0},
+	}
+	for _, td := range tests {
+		entries, err := h.SearchUnique(td.q)
+		if err != nil {
+			t.Errorf("search for '%s' failed: %v", td.q, err)
+		}
+		if len(entries) != td.n {
+			t.Errorf("bad no. of results for '%s'. Expected=%d, Got=%d", td.q, td.n, len(entries))
 		}
 	}
 }
+
+func TestNewMissing(t *testing.T) {
+	if _, err := New("/does/not/exist.db"); err == nil {
+		t.Error("opened non-existent database")
+	} else if _, ok := err.(*OpenError); !ok {
+		t.Errorf("bad error type: %T", err)
+	}
+}
+
+// TestDefault tests that a failure to open the default History isn't cached.
+func TestDefault(t *testing.T) {
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+
+	prev := DefaultHistoryPath
+	defer func() { DefaultHistoryPath, history = prev, nil }()
+
+	DefaultHistoryPath = filepath.Join(dir, "missing.db")
+	if _, err := Default(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bad error. Expected=ErrNotFound, Got=%v", err)
+	}
+	DefaultHistoryPath = filepath.Join(dir, fixtures.HistoryFile)
+	h, err := Default()
+	if err != nil {
+		t.Fatalf("error not retried: %v", err)
+	}
+	if h2, _ := Default(); h2 != h {
+		t.Error("History not cached")
+	}
+	h.DB.Close()
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New("/does/not/exist.db")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing database: Expected=ErrNotFound, Got=%v", err)
+	}
+
+	// Wrong database
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+	h, err := New(filepath.Join(dir, fixtures.CloudTabsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.DB.Close()
+	if _, err := h.Recent(10); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("bad schema: Expected=ErrUnsupportedSchema, Got=%v", err)
+	}
+}
+
+func TestContext(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	funcs := map[string]func() error{
+		"RecentContext":       func() error { _, err := h.RecentContext(ctx, 10); return err },
+		"SearchContext":       func() error { _, err := h.SearchContext(ctx, "google"); return err },
+		"SearchRankedContext": func() error { _, err := h.SearchRankedContext(ctx, "google"); return err },
+		"FindContext":         func() error { _, err := h.FindContext(ctx, Query{}); return err },
+		"ChainContext":        func() error { _, err := h.ChainContext(ctx, 17); return err },
+		"ChainsContext":       func() error { _, err := h.ChainsContext(ctx, Query{}); return err },
+	}
+	for name, fn := range funcs {
+		if err := fn(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: Expected=%v, Got=%v", name, context.Canceled, err)
+		}
+	}
+
+	dir, cleanupDir := fixtures.Dir(t)
+	defer cleanupDir()
+	if _, err := NewContext(ctx, filepath.Join(dir, fixtures.HistoryFile)); !errors.Is(err, context.Canceled) {
+		t.Errorf("NewContext: Expected=%v, Got=%v", context.Canceled, err)
+	}
+}
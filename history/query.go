@@ -0,0 +1,250 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-25
+//
+
+package history
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Name of the SQL driver used to open history databases. It's the
+// sqlite3 driver plus the functions in sqlFuncs.
+const driverName = "sqlite3_safari_history"
+
+var registerOnce sync.Once
+
+// SQL functions available in queries.
+var sqlFuncs = map[string]interface{}{
+	"url_host":       urlHost,         // url_host(url) -> hostname without port
+	"recency_weight": recencyWeight,   // recency_weight(visit_time, now) -> frecency weight
+	"match_quality":  sqlMatchQuality, // match_quality(query, title, url) -> score multiplier
+}
+
+// registerDriver registers the SQL driver on first call.
+func registerDriver() {
+	registerOnce.Do(func() {
+		sql.Register(driverName, &sqlite3.SQLiteDriver{
+			ConnectHook: func(c *sqlite3.SQLiteConn) error {
+				for name, fn := range sqlFuncs {
+					if err := c.RegisterFunc(name, fn, true); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	})
+}
+
+// urlHost returns the lowercase hostname of URL s, or "" if it has none.
+func urlHost(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Query specifies which History entries Find returns. Each visit to a URL
+// is a separate Entry unless Unique is set. As with Recent and Search,
+// entries without a title or with a non-HTTP* scheme are ignored.
+// Zero-value fields are ignored.
+type Query struct {
+	Since     time.Time // Only return visits at or after this time
+	Until     time.Time // Only return visits before this time
+	Domain    string    // Only return URLs on this host or its subdomains
+	URLPrefix string    // Only return URLs starting with this string
+	MinVisits int       // Only return URLs visited at least this many times in total
+	Limit     int       // Maximum number of entries to return. 0 means no limit.
+	Offset    int       // Number of entries to skip, for pagination
+
+	// Unique returns one Entry per URL instead of one per visit.
+	// The Entry's Time is that of the most recent matching visit, and
+	// its VisitCount is the number of matching visits.
+	Unique bool
+}
+
+// Find returns History entries matching Query q, newest first.
+func Find(q Query) ([]*Entry, error) {
+	return FindContext(context.Background(), q)
+}
+
+// FindContext is like Find, but aborts if ctx is cancelled.
+func FindContext(ctx context.Context, q Query) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.FindContext(ctx, q)
+}
+
+// Find returns History entries matching Query q, newest first.
+//
+// Domain matching uses Safari's domain_expansion column to narrow the
+// search before checking the hostnames of URLs. For pagination, increase
+// Offset by Limit on each call.
+func (h *History) Find(q Query) ([]*Entry, error) {
+	return h.FindContext(context.Background(), q)
+}
+
+// FindContext is like Find, but aborts if ctx is cancelled.
+func (h *History) FindContext(ctx context.Context, q Query) ([]*Entry, error) {
+	return h.find(ctx, q, nil)
+}
+
+// Each calls fn for each History entry matching Query q, newest first.
+func Each(ctx context.Context, q Query, fn func(*Entry) error) error {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return err
+	}
+	return h.Each(ctx, q, fn)
+}
+
+// Each calls fn for each History entry matching Query q, newest first.
+// Unlike Find, it reads entries from the database one at a time, so uses
+// little memory however many entries match.
+//
+// Iteration stops if ctx is cancelled or fn returns an error, and Each
+// returns that error. Return ErrStop from fn to stop early without an
+// error. Each also returns an error if a row can't be read.
+func (h *History) Each(ctx context.Context, q Query, fn func(*Entry) error) error {
+	stmt, args := q.sql(nil)
+	err := h.each(ctx, stmt, args, func(e *Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(e)
+	})
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+// Columns selected for each visit, which query scans into an Entry.
+// Redirect visits have no title.
+const visitColumns = `url, visit_time, COALESCE(title, ''), visit_count, visit_time,
+		history_visits.id,
+		COALESCE((SELECT i.url FROM history_visits v
+			JOIN history_items i ON i.id = v.history_item
+			WHERE v.id = history_visits.redirect_source), ''),
+		COALESCE((SELECT i.url FROM history_visits v
+			JOIN history_items i ON i.id = v.history_item
+			WHERE v.id = history_visits.redirect_destination), '')`
+
+// find returns History entries matching Query q whose titles also contain
+// all of words.
+func (h *History) find(ctx context.Context, q Query, words []string) ([]*Entry, error) {
+	stmt, args := q.sql(words)
+	return h.query(ctx, stmt, args...)
+}
+
+// sql returns an SQL query and its arguments for the History entries
+// matching q whose titles also contain all of words.
+func (q Query) sql(words []string) (string, []interface{}) {
+	var (
+		args []interface{}
+		stmt = `
+	SELECT ` + visitColumns
+	)
+
+	if q.Unique {
+		// Title of the most recent visit. Bare columns in an aggregate
+		// query aren't guaranteed to come from any particular row.
+		stmt = `
+	SELECT url, MAX(visit_time) AS last_visit,
+		(SELECT v.title FROM history_visits v
+			WHERE v.history_item = history_items.id AND v.title <> ''
+			ORDER BY v.visit_time DESC LIMIT 1),
+		COUNT(*), MIN(visit_time), 0, '', ''`
+	}
+	stmt += `
+		FROM history_items
+			LEFT JOIN history_visits
+				ON history_visits.history_item = history_items.id
+		WHERE title <> '' AND url LIKE 'http%'`
+
+	for _, s := range words {
+		stmt += ` AND title LIKE ?`
+		args = append(args, "%"+s+"%")
+	}
+	where, filterArgs := q.filter()
+	stmt += where
+	args = append(args, filterArgs...)
+
+	if q.Unique {
+		stmt += `
+		GROUP BY history_items.id
+		ORDER BY last_visit DESC LIMIT ? OFFSET ?`
+	} else {
+		stmt += `
+		ORDER BY visit_time DESC LIMIT ? OFFSET ?`
+	}
+	args = append(args, q.limit(), q.Offset)
+
+	return stmt, args
+}
+
+// filter returns SQL conditions (each starting with AND) and arguments for
+// q's Since, Until, Domain, URLPrefix and MinVisits.
+func (q Query) filter() (string, []interface{}) {
+	var (
+		where string
+		args  []interface{}
+	)
+	if !q.Since.IsZero() {
+		where += ` AND visit_time >= ?`
+		args = append(args, toNSDate(q.Since))
+	}
+	if !q.Until.IsZero() {
+		where += ` AND visit_time < ?`
+		args = append(args, toNSDate(q.Until))
+	}
+	if q.Domain != "" {
+		domain := strings.ToLower(strings.TrimPrefix(q.Domain, "www."))
+		// domain_expansion is the hostname without "www." and the public
+		// suffix, so always contains the first label of the domain. It's
+		// NULL for IP addresses and single-label hosts like localhost.
+		// instr and substr are used instead of LIKE because hostnames may
+		// contain "_", which LIKE treats as a wildcard.
+		label := strings.SplitN(domain, ".", 2)[0]
+		where += ` AND (domain_expansion IS NULL OR instr(lower(domain_expansion), ?) > 0)
+			AND (url_host(url) = ? OR substr(url_host(url), -length(?)) = ?)`
+		args = append(args, label, domain, "."+domain, "."+domain)
+	}
+	if q.URLPrefix != "" {
+		where += ` AND substr(url, 1, length(?)) = ?`
+		args = append(args, q.URLPrefix, q.URLPrefix)
+	}
+	if q.MinVisits > 0 {
+		where += ` AND visit_count >= ?`
+		args = append(args, q.MinVisits)
+	}
+	return where, args
+}
+
+// limit returns q.Limit as an SQL LIMIT.
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return -1 // no limit
+	}
+	return q.Limit
+}
+
+// toNSDate converts t to seconds since the NSDate epoch.
+func toNSDate(t time.Time) float64 {
+	return float64(t.UnixNano())/1e9 - tsOffset
+}
@@ -0,0 +1,257 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-25
+//
+
+package history
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+func TestFind(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	hoursAgo := func(n int) time.Time {
+		return fixtures.HistoryTime.Add(-time.Duration(n) * time.Hour)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		n    int
+	}{
+		{"all", Query{}, 20},
+		{"since", Query{Since: hoursAgo(5)}, 6},
+		{"since sub-second", Query{Since: fixtures.HistoryTime.Add(500 * time.Millisecond)}, 0},
+		{"until sub-second", Query{Since: hoursAgo(1), Until: fixtures.HistoryTime.Add(500 * time.Millisecond)}, 2},
+		{"range", Query{Since: hoursAgo(300), Until: hoursAgo(100)}, 4},
+		{"domain", Query{Domain: "wiki.example.com"}, 6},
+		{"parent domain", Query{Domain: "example.com"}, 7},
+		{"www domain", Query{Domain: "www.google.com"}, 6},
+		{"no such domain", Query{Domain: "le.com"}, 0},
+		{"single-label domain", Query{Domain: "intranet"}, 1},
+		{"prefix", Query{URLPrefix: "https://wiki.example.com/Pro"}, 2},
+		{"min visits", Query{MinVisits: 4}, 9},
+		{"combined", Query{Domain: "google.com", MinVisits: 2, Since: hoursAgo(24)}, 2},
+		{"limit", Query{Limit: 5}, 5},
+		{"offset", Query{Offset: 15}, 5},
+		{"unique", Query{Unique: true}, 8},
+		{"unique since", Query{Since: hoursAgo(5), Unique: true}, 5},
+		{"unique domain", Query{Domain: "example.com", Unique: true}, 3},
+		{"unique offset", Query{Offset: 5, Unique: true}, 3},
+	}
+
+	for _, td := range tests {
+		entries, err := h.Find(td.q)
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			continue
+		}
+		if len(entries) != td.n {
+			t.Errorf("%s: bad no. of entries. Expected=%d, Got=%d", td.name, td.n, len(entries))
+		}
+		for i, e := range entries {
+			if !td.q.Since.IsZero() && e.Time.Before(td.q.Since) {
+				t.Errorf("%s: entry %d before Since: %v", td.name, i, e.Time)
+			}
+			if !td.q.Until.IsZero() && !e.Time.Before(td.q.Until) {
+				t.Errorf("%s: entry %d not before Until: %v", td.name, i, e.Time)
+			}
+		}
+	}
+}
+
+// TestFindDomain tests that Domain only matches the domain and its
+// subdomains, and that "_" in a domain isn't a wildcard.
+func TestFindDomain(t *testing.T) {
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+	path := filepath.Join(dir, fixtures.HistoryFile)
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []struct{ url, domain string }{
+		{"https://notexample.com/", "notexample"},
+		{"https://a.myxhost.lan/", "a.myxhost"},
+		{"https://my_host.lan/", "my_host"},
+	}
+	for i, it := range items {
+		id := 100 + i
+		_, err := db.Exec(`INSERT INTO history_items
+			(id, url, domain_expansion, visit_count, daily_visit_counts,
+				should_recompute_derived_visit_counts, visit_count_score)
+			VALUES (?, ?, ?, 1, x'', 0, 100)`, id, it.url, it.domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`INSERT INTO history_visits (id, history_item, visit_time, title)
+			VALUES (?, ?, 0, 'Test')`, id, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	h, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.DB.Close()
+
+	tests := []struct {
+		domain string
+		n      int
+	}{
+		{"example.com", 7},
+		{"notexample.com", 1},
+		{"my_host.lan", 1},
+		{"myxhost.lan", 1},
+	}
+	for _, td := range tests {
+		entries, err := h.Find(Query{Domain: td.domain})
+		if err != nil {
+			t.Errorf("%s: %v", td.domain, err)
+			continue
+		}
+		if len(entries) != td.n {
+			t.Errorf("%s: bad no. of entries. Expected=%d, Got=%d", td.domain, td.n, len(entries))
+		}
+	}
+}
+
+func TestFindPagination(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	var (
+		q    = Query{Domain: "example.com", Limit: 3}
+		seen = map[string]bool{}
+		n    int
+	)
+	for {
+		entries, err := h.Find(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for _, e := range entries {
+			key := e.URL + e.Time.String()
+			if seen[key] {
+				t.Errorf("duplicate entry: %#v", e)
+			}
+			seen[key] = true
+		}
+		n += len(entries)
+		q.Offset += q.Limit
+	}
+	if n != 7 {
+		t.Errorf("bad no. of entries. Expected=7, Got=%d", n)
+	}
+}
+
+func TestEach(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	var n int
+	err := h.Each(context.Background(), Query{}, func(e *Entry) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Errorf("bad no. of entries. Expected=20, Got=%d", n)
+	}
+
+	// Stop early
+	n = 0
+	err = h.Each(context.Background(), Query{}, func(e *Entry) error {
+		n++
+		if n == 5 {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("ErrStop returned error: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("bad no. of entries. Expected=5, Got=%d", n)
+	}
+
+	// Error from fn
+	errTest := errors.New("test error")
+	err = h.Each(context.Background(), Query{}, func(e *Entry) error { return errTest })
+	if err != errTest {
+		t.Errorf("bad error. Expected=%v, Got=%v", errTest, err)
+	}
+
+	// Cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = h.Each(ctx, Query{}, func(e *Entry) error {
+		n++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("bad error. Expected=%v, Got=%v", context.Canceled, err)
+	}
+	if n != 1 {
+		t.Errorf("bad no. of entries. Expected=1, Got=%d", n)
+	}
+}
+
+// TestEachRows tests that NULLs are handled and scan errors returned.
+func TestEachRows(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	var entries []*Entry
+	err := h.each(context.Background(), `SELECT NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL`, nil,
+		func(e *Entry) error {
+			entries = append(entries, e)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("bad no. of entries. Expected=1, Got=%d", len(entries))
+	}
+	if e := entries[0]; e.Title != "" || e.URL != "" || !e.Time.IsZero() || !e.FirstVisit.IsZero() {
+		t.Errorf("bad entry for NULL row: %#v", e)
+	}
+
+	err = h.each(context.Background(), `SELECT 'url', 'not a time', '', 0, 0, 0, '', ''`, nil,
+		func(e *Entry) error { return nil })
+	if err == nil {
+		t.Error("bad row didn't return error")
+	}
+}
+
+func TestNSDate(t *testing.T) {
+	x := time.Date(2019, 2, 1, 12, 0, 0, 500123000, time.UTC)
+	got := fromNSDate(toNSDate(x))
+	if d := got.Sub(x); d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("bad round trip. Expected=%v, Got=%v", x, got)
+	}
+}
@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-26
+//
+
+package history
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/deanishe/go-safari/internal/match"
+)
+
+// now returns the time SearchRanked measures recency from.
+var now = time.Now
+
+// Weights of visits by age for frecency scoring. Visits older than the
+// last bucket have weight recencyWeightMin.
+var recencyBuckets = []struct {
+	days   float64
+	weight int64
+}{
+	{4, 100},
+	{14, 70},
+	{31, 50},
+	{90, 30},
+}
+
+const recencyWeightMin = 10
+
+// recencyWeight returns the frecency weight of a visit at NSDate visitTime,
+// where the current time is NSDate now.
+func recencyWeight(visitTime, now float64) int64 {
+	days := (now - visitTime) / 86400
+	for _, b := range recencyBuckets {
+		if days < b.days {
+			return b.weight
+		}
+	}
+	return recencyWeightMin
+}
+
+// SearchRanked searches History entries by title and URL, and returns
+// one Entry per URL, most relevant first.
+func SearchRanked(query string) ([]*Entry, error) {
+	return SearchRankedContext(context.Background(), query)
+}
+
+// SearchRankedContext is like SearchRanked, but aborts if ctx is cancelled.
+func SearchRankedContext(ctx context.Context, query string) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.SearchRankedContext(ctx, query)
+}
+
+// SearchRanked searches History entries by title and URL, and returns at
+// most MaxSearchResults entries, most relevant first. Entries without a
+// title or with a non-HTTP* scheme are ignored.
+//
+// The query is split into individual words, each of which must occur in
+// either the title or the URL. Entries are scored by frecency: each
+// matching visit is weighted by its age, so frequently- and
+// recently-visited URLs rank highest. The score is then multiplied by the
+// quality of the match: a word matching the start of the hostname counts
+// most, followed by a word matching the start of a word in the title.
+// An empty query matches nothing.
+func (h *History) SearchRanked(query string) ([]*Entry, error) {
+	return h.SearchRankedContext(context.Background(), query)
+}
+
+// SearchRankedContext is like SearchRanked, but aborts if ctx is cancelled.
+func (h *History) SearchRankedContext(ctx context.Context, query string) ([]*Entry, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	// Entries are scored, sorted and limited by SQLite, so only the
+	// results are read
+	var (
+		args = []interface{}{query, toNSDate(now())}
+		stmt = `
+	SELECT url, last_visit, last_title, visits, first_visit, 0, '', '',
+		weight * match_quality(?, last_title, url) AS score
+		FROM (
+			SELECT url, MAX(visit_time) AS last_visit,
+				(SELECT v.title FROM history_visits v
+					WHERE v.history_item = history_items.id AND v.title <> ''
+					ORDER BY v.visit_time DESC LIMIT 1) AS last_title,
+				COUNT(*) AS visits, MIN(visit_time) AS first_visit,
+				SUM(recency_weight(visit_time, ?)) AS weight
+				FROM history_items
+					LEFT JOIN history_visits
+						ON history_visits.history_item = history_items.id
+				WHERE title <> '' AND url LIKE 'http%'`
+	)
+
+	for _, s := range words {
+		stmt += ` AND (title LIKE ? OR url LIKE ?)`
+		args = append(args, "%"+s+"%", "%"+s+"%")
+	}
+	stmt += `
+				GROUP BY history_items.id)
+		ORDER BY score DESC, last_visit DESC LIMIT ?`
+	args = append(args, MaxSearchResults)
+
+	return h.query(ctx, stmt, args...)
+}
+
+// sqlMatchQuality is matchQuality for SQL queries.
+func sqlMatchQuality(query, title, URL string) float64 {
+	return matchQuality(strings.Fields(query), title, URL)
+}
+
+// matchQuality returns a multiplier for an entry's score based on where
+// words match its title and URL.
+func matchQuality(words []string, title, URL string) float64 {
+	if len(words) == 0 {
+		return 1
+	}
+
+	var (
+		host   = strings.TrimPrefix(urlHost(URL), "www.")
+		fields = match.Words(title)
+		q      float64
+	)
+	for _, w := range words {
+		w = strings.ToLower(w)
+		switch {
+		case strings.HasPrefix(host, w):
+			q += 4
+		case match.HasPrefix(fields, w):
+			q += 2
+		default:
+			q++
+		}
+	}
+	return q / float64(len(words))
+}
+
+// ByScore sorts Entries by Score (highest first), then by Time (newest first).
+type ByScore []*Entry
+
+// Implement sort.Interface
+func (s ByScore) Len() int      { return len(s) }
+func (s ByScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s ByScore) Less(i, j int) bool {
+	if s[i].Score != s[j].Score {
+		return s[i].Score > s[j].Score
+	}
+	return s[i].Time.After(s[j].Time)
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-26
+//
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+func TestSearchRanked(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	now = func() time.Time { return fixtures.HistoryTime }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		q    string
+		urls []string
+	}{
+		// Hostname matches beat title matches, frequent beats rare
+		{"go", []string{
+			"https://www.google.com/",
+			"https://golang.org/",
+			"https://www.google.com/search?q=golang",
+		}},
+		// Hostname match beats URL-only match
+		{"example", []string{
+			"https://wiki.example.com/Home",
+			"https://wiki.example.com/Projects",
+			"http://news.example.com/",
+		}},
+		// Words may match title or URL
+		{"wiki projects", []string{"https://wiki.example.com/Projects"}},
+		{"alfredapp productivity", []string{"https://www.alfredapp.com/"}},
+		{"files", nil},
+		{"", nil},
+	}
+
+	for _, td := range tests {
+		entries, err := h.SearchRanked(td.q)
+		if err != nil {
+			t.Errorf("search for '%s' failed: %v", td.q, err)
+			continue
+		}
+		if len(entries) != len(td.urls) {
+			t.Errorf("bad no. of results for '%s'. Expected=%d, Got=%d", td.q, len(td.urls), len(entries))
+			continue
+		}
+		for i, e := range entries {
+			if e.URL != td.urls[i] {
+				t.Errorf("bad result %d for '%s'. Expected=%s, Got=%s", i, td.q, td.urls[i], e.URL)
+			}
+			if e.Score <= 0 {
+				t.Errorf("result %d for '%s' has no score", i, td.q)
+			}
+		}
+	}
+}
+
+func TestRecencyWeight(t *testing.T) {
+	day := 86400.0
+	tests := []struct {
+		days float64
+		x    int64
+	}{
+		{0, 100},
+		{3.9, 100},
+		{4, 70},
+		{20, 50},
+		{60, 30},
+		{365, 10},
+	}
+	for _, td := range tests {
+		v := recencyWeight(1000*day-td.days*day, 1000*day)
+		if v != td.x {
+			t.Errorf("bad weight for %v days. Expected=%d, Got=%d", td.days, td.x, v)
+		}
+	}
+}
+
+func TestMatchQuality(t *testing.T) {
+	tests := []struct {
+		words      []string
+		title, URL string
+		x          float64
+	}{
+		{nil, "Google", "https://www.google.com/", 1},
+		{[]string{"goo"}, "Google", "https://www.google.com/", 4},
+		{[]string{"search"}, "golang - Google Search", "https://www.google.com/search?q=golang", 2},
+		{[]string{"oogle"}, "Google", "https://www.google.com/", 1},
+		{[]string{"goo", "oogle"}, "Google", "https://www.google.com/", 2.5},
+	}
+	for _, td := range tests {
+		v := matchQuality(td.words, td.title, td.URL)
+		if v != td.x {
+			t.Errorf("bad quality for %v. Expected=%v, Got=%v", td.words, td.x, v)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-27
+//
+
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/deanishe/go-safari/internal/errs"
+)
+
+// Maximum number of redirects followed when reconstructing a chain.
+const maxRedirects = 50
+
+// Chain returns the chain of redirects that visit visitID is part of,
+// from the first visit to the final destination. If the visit was not
+// redirected, the chain contains only that visit.
+//
+// Unlike other queries, Chain returns visits without a title, as Safari
+// doesn't record titles for visits that redirected.
+func Chain(visitID int64) ([]*Entry, error) {
+	return ChainContext(context.Background(), visitID)
+}
+
+// ChainContext is like Chain, but aborts if ctx is cancelled.
+func ChainContext(ctx context.Context, visitID int64) ([]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.ChainContext(ctx, visitID)
+}
+
+// Chain returns the chain of redirects that visit visitID is part of.
+func (h *History) Chain(visitID int64) ([]*Entry, error) {
+	return h.ChainContext(context.Background(), visitID)
+}
+
+// ChainContext is like Chain, but aborts if ctx is cancelled.
+func (h *History) ChainContext(ctx context.Context, visitID int64) ([]*Entry, error) {
+	var (
+		start int64
+		stmt  = `
+	WITH RECURSIVE chain(id, depth) AS (
+		SELECT ?, 0
+		UNION ALL
+		SELECT src.id, chain.depth + 1
+			FROM history_visits v JOIN chain ON v.id = chain.id
+				-- Stop at the last visit that exists
+				JOIN history_visits src ON src.id = v.redirect_source
+			WHERE chain.depth < ?
+	)
+	SELECT id FROM chain ORDER BY depth DESC LIMIT 1`
+	)
+	if err := h.DB.QueryRowContext(ctx, stmt, visitID, maxRedirects).Scan(&start); err != nil {
+		return nil, fmt.Errorf("error running query:%s error: %w", stmt, errs.SQL(err))
+	}
+
+	entries, err := h.chainFrom(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no visit with ID %d", ErrNotFound, visitID)
+	}
+	return entries, nil
+}
+
+// Destination returns the final visit in the redirect chain that visit
+// visitID is part of. If the visit was not redirected, it returns that visit.
+func Destination(visitID int64) (*Entry, error) {
+	return DestinationContext(context.Background(), visitID)
+}
+
+// DestinationContext is like Destination, but aborts if ctx is cancelled.
+func DestinationContext(ctx context.Context, visitID int64) (*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.DestinationContext(ctx, visitID)
+}
+
+// Destination returns the final visit in visit visitID's redirect chain.
+func (h *History) Destination(visitID int64) (*Entry, error) {
+	return h.DestinationContext(context.Background(), visitID)
+}
+
+// DestinationContext is like Destination, but aborts if ctx is cancelled.
+func (h *History) DestinationContext(ctx context.Context, visitID int64) (*Entry, error) {
+	entries, err := h.ChainContext(ctx, visitID)
+	if err != nil {
+		return nil, err
+	}
+	return entries[len(entries)-1], nil
+}
+
+// Chains returns all redirect chains whose first visit matches Query q,
+// newest first. Each chain runs from the first visit to the final
+// destination, and contains at least two visits.
+//
+// Since, Until, Domain, URLPrefix and MinVisits apply to the first visit
+// in each chain, e.g. use Domain to find all links via a URL shortener.
+// Limit and Offset apply to chains. Unique is ignored.
+func Chains(q Query) ([][]*Entry, error) {
+	return ChainsContext(context.Background(), q)
+}
+
+// ChainsContext is like Chains, but aborts if ctx is cancelled.
+func ChainsContext(ctx context.Context, q Query) ([][]*Entry, error) {
+	h, err := defaultContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.ChainsContext(ctx, q)
+}
+
+// Chains returns all redirect chains whose first visit matches Query q.
+func (h *History) Chains(q Query) ([][]*Entry, error) {
+	return h.ChainsContext(context.Background(), q)
+}
+
+// ChainsContext is like Chains, but aborts if ctx is cancelled.
+func (h *History) ChainsContext(ctx context.Context, q Query) ([][]*Entry, error) {
+	var (
+		ids  []int64
+		stmt = `
+	SELECT history_visits.id
+		FROM history_items
+			LEFT JOIN history_visits
+				ON history_visits.history_item = history_items.id
+		WHERE redirect_source IS NULL AND redirect_destination IS NOT NULL
+			AND url LIKE 'http%'`
+	)
+
+	where, args := q.filter()
+	stmt += where + `
+		ORDER BY visit_time DESC LIMIT ? OFFSET ?`
+	args = append(args, q.limit(), q.Offset)
+
+	rows, err := h.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error running query:%s with args: %+v\nerror: %w", stmt, args, errs.SQL(err))
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, errs.SQL(err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errs.SQL(err)
+	}
+
+	var chains [][]*Entry
+	for _, id := range ids {
+		entries, err := h.chainFrom(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, entries)
+	}
+	return chains, nil
+}
+
+// chainFrom returns the visits in the redirect chain starting at visit id.
+func (h *History) chainFrom(ctx context.Context, id int64) ([]*Entry, error) {
+	stmt := `
+	WITH RECURSIVE chain(id, depth) AS (
+		SELECT ?, 0
+		UNION ALL
+		SELECT v.redirect_destination, chain.depth + 1
+			FROM history_visits v JOIN chain ON v.id = chain.id
+			WHERE v.redirect_destination IS NOT NULL AND chain.depth < ?
+	)
+	SELECT ` + visitColumns + `
+		FROM chain
+			JOIN history_visits ON history_visits.id = chain.id
+			JOIN history_items ON history_items.id = history_visits.history_item
+		ORDER BY chain.depth`
+
+	return h.query(ctx, stmt, id, maxRedirects)
+}
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-27
+//
+
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+// Redirect chain in History.db fixture.
+var (
+	chainURLs = []string{"https://bit.ly/golang", "https://t.co/golang", "https://golang.org/"}
+	chainIDs  = []int64{17, 18, 19}
+)
+
+// checkChain verifies that entries is the fixture redirect chain.
+func checkChain(t *testing.T, entries []*Entry) {
+	if len(entries) != len(chainURLs) {
+		t.Errorf("bad chain length. Expected=%d, Got=%d", len(chainURLs), len(entries))
+		return
+	}
+	for i, e := range entries {
+		if e.URL != chainURLs[i] || e.VisitID != chainIDs[i] {
+			t.Errorf("bad visit %d. Expected=%s (%d), Got=%s (%d)", i, chainURLs[i], chainIDs[i], e.URL, e.VisitID)
+		}
+		var from, to string
+		if i > 0 {
+			from = chainURLs[i-1]
+		}
+		if i < len(chainURLs)-1 {
+			to = chainURLs[i+1]
+		}
+		if e.RedirectedFrom != from {
+			t.Errorf("bad RedirectedFrom for visit %d. Expected=%q, Got=%q", i, from, e.RedirectedFrom)
+		}
+		if e.RedirectedTo != to {
+			t.Errorf("bad RedirectedTo for visit %d. Expected=%q, Got=%q", i, to, e.RedirectedTo)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	// Any visit in the chain returns the whole chain
+	for _, id := range chainIDs {
+		entries, err := h.Chain(id)
+		if err != nil {
+			t.Errorf("chain for %d: %v", id, err)
+			continue
+		}
+		checkChain(t, entries)
+	}
+
+	// Visit wasn't redirected
+	entries, err := h.Chain(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].VisitID != 20 {
+		t.Errorf("bad chain for unredirected visit: %#v", entries)
+	}
+
+	if _, err := h.Chain(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing visit: Expected=ErrNotFound, Got=%v", err)
+	}
+}
+
+// TestChainDeleted tests that a chain starts at the earliest visit that
+// still exists if the first visit has been deleted.
+func TestChainDeleted(t *testing.T) {
+	dir, cleanup := fixtures.Dir(t)
+	defer cleanup()
+	path := filepath.Join(dir, fixtures.HistoryFile)
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DELETE FROM history_visits WHERE id = 17`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	h, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.DB.Close()
+
+	entries, err := h.Chain(19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].VisitID != 18 || entries[1].VisitID != 19 {
+		t.Errorf("bad chain. Expected=[18 19], Got=%#v", entries)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	e, err := h.Destination(17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.VisitID != 19 || e.Title != "The Go Programming Language" {
+		t.Errorf("bad destination: %#v", e)
+	}
+}
+
+func TestChains(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		q    Query
+		n    int
+	}{
+		{"all", Query{}, 1},
+		{"shortener", Query{Domain: "bit.ly"}, 1},
+		{"not first", Query{Domain: "t.co"}, 0},
+		{"before", Query{Until: fixtures.HistoryTime.Add(-7 * time.Hour)}, 0},
+		{"after", Query{Since: fixtures.HistoryTime.Add(-7 * time.Hour)}, 1},
+	}
+	for _, td := range tests {
+		chains, err := h.Chains(td.q)
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			continue
+		}
+		if len(chains) != td.n {
+			t.Errorf("%s: bad no. of chains. Expected=%d, Got=%d", td.name, td.n, len(chains))
+			continue
+		}
+		for _, c := range chains {
+			checkChain(t, c)
+		}
+	}
+}
+
+// TestRedirectedEntries tests that other queries populate redirect fields.
+func TestRedirectedEntries(t *testing.T) {
+	h, cleanup := testHistory(t)
+	defer cleanup()
+
+	entries, err := h.Find(Query{Domain: "golang.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("bad no. of entries. Expected=3, Got=%d", len(entries))
+	}
+	for _, e := range entries {
+		var from string
+		if e.VisitID == 19 {
+			from = "https://t.co/golang"
+		}
+		if e.RedirectedFrom != from || e.RedirectedTo != "" {
+			t.Errorf("bad redirects for visit %d: %q -> %q", e.VisitID, e.RedirectedFrom, e.RedirectedTo)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package importer
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/deanishe/go-safari"
+)
+
+// Names of Chrome's root folders, in the order they are imported.
+var chromeRoots = []struct {
+	key, title string
+}{
+	{"bookmark_bar", "Bookmarks Bar"},
+	{"other", "Other Bookmarks"},
+	{"synced", "Mobile Bookmarks"},
+}
+
+// chromeNode is a folder or bookmark in Chrome's Bookmarks file.
+type chromeNode struct {
+	Type     string        `json:"type"` // "folder" or "url"
+	Name     string        `json:"name"`
+	URL      string        `json:"url"`
+	Children []*chromeNode `json:"children"`
+}
+
+// ParseChrome reads Chrome's (or Chromium's, Brave's etc.) Bookmarks JSON
+// file. Each of Chrome's root folders (Bookmarks Bar, Other Bookmarks and
+// Mobile Bookmarks) that contains any bookmarks becomes a Folder.
+func ParseChrome(r io.Reader) (*safari.Folder, error) {
+	var data struct {
+		Roots map[string]*chromeNode `json:"roots"`
+	}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	root := safari.NewFolder(rootTitle, nil)
+	for _, cr := range chromeRoots {
+		n := data.Roots[cr.key]
+		if n == nil || len(n.Children) == 0 {
+			continue
+		}
+		addChromeNodes(safari.NewFolder(cr.title, root), n.Children)
+	}
+
+	return root, nil
+}
+
+// addChromeNodes recursively adds nodes to Folder parent.
+func addChromeNodes(parent *safari.Folder, nodes []*chromeNode) {
+	for _, n := range nodes {
+		switch n.Type {
+
+		case "folder":
+			addChromeNodes(safari.NewFolder(n.Name, parent), n.Children)
+
+		case "url":
+			safari.NewBookmark(n.Name, n.URL, parent)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/deanishe/go-safari"
+
+	// sqlite3 registers itself with sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Types of rows in moz_bookmarks.
+const (
+	firefoxTypeBookmark = 1
+	firefoxTypeFolder   = 2
+)
+
+// GUIDs of Firefox's root folders, in the order they are imported.
+// The tags root is ignored.
+var firefoxRoots = []struct {
+	guid, title string
+}{
+	{"toolbar_____", "Bookmarks Toolbar"},
+	{"menu________", "Bookmarks Menu"},
+	{"unfiled_____", "Other Bookmarks"},
+	{"mobile______", "Mobile Bookmarks"},
+}
+
+// firefoxRow is a row from moz_bookmarks joined with moz_places.
+type firefoxRow struct {
+	id, parent, typ int64
+	guid, title     string
+	url             string
+}
+
+// ParseFirefox reads bookmarks from a Firefox places.sqlite database.
+// Each of Firefox's root folders (Bookmarks Toolbar, Bookmarks Menu, Other
+// Bookmarks and Mobile Bookmarks) that contains any bookmarks becomes a
+// Folder.
+//
+// Firefox locks the database while it is running, so you may need to work
+// on a copy.
+func ParseFirefox(filename string) (*safari.Folder, error) {
+	return ParseFirefoxContext(context.Background(), filename)
+}
+
+// ParseFirefoxContext is like ParseFirefox, but aborts if ctx is cancelled.
+func ParseFirefoxContext(ctx context.Context, filename string) (*safari.Folder, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_timeout=9999999", filename))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open database %s: %s", filename, err)
+	}
+	defer db.Close()
+
+	q := `
+	SELECT b.id, b.parent, b.type, IFNULL(b.guid, ''), IFNULL(b.title, ''), IFNULL(p.url, '')
+		FROM moz_bookmarks b
+			LEFT JOIN moz_places p
+				ON b.fk = p.id
+		ORDER BY b.parent, b.position`
+
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("error running query:%s error: %w", q, err)
+	}
+	defer rows.Close()
+
+	var (
+		children = map[int64][]*firefoxRow{}
+		guid2row = map[string]*firefoxRow{}
+	)
+	for rows.Next() {
+		r := &firefoxRow{}
+		if err := rows.Scan(&r.id, &r.parent, &r.typ, &r.guid, &r.title, &r.url); err != nil {
+			return nil, err
+		}
+		children[r.parent] = append(children[r.parent], r)
+		guid2row[r.guid] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	root := safari.NewFolder(rootTitle, nil)
+	for _, fr := range firefoxRoots {
+		r := guid2row[fr.guid]
+		if r == nil || len(children[r.id]) == 0 {
+			continue
+		}
+		addFirefoxRows(safari.NewFolder(fr.title, root), r.id, children)
+	}
+
+	return root, nil
+}
+
+// addFirefoxRows recursively adds the children of row id to Folder parent.
+func addFirefoxRows(parent *safari.Folder, id int64, children map[int64][]*firefoxRow) {
+	for _, r := range children[id] {
+		switch r.typ {
+
+		case firefoxTypeFolder:
+			addFirefoxRows(safari.NewFolder(r.title, parent), r.id, children)
+
+		case firefoxTypeBookmark:
+			// Ignore smart bookmarks (saved searches)
+			if r.url == "" || strings.HasPrefix(r.url, "place:") {
+				continue
+			}
+			safari.NewBookmark(r.title, r.url, parent)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package importer
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/deanishe/go-safari"
+)
+
+var (
+	// Matches the tags in a Netscape bookmarks file that we care about
+	// and any text that follows them.
+	tagRegexp  = regexp.MustCompile(`(?is)<(/?)(dl|h3|a)\b([^>]*)>([^<]*)`)
+	hrefRegexp = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// ParseHTML reads a Netscape Bookmark File (NETSCAPE-Bookmark-file-1), as
+// exported by all major browsers.
+//
+// The format is not real HTML, so it is parsed leniently: <H3> elements
+// start a folder, whose contents are the following <DL> list, and <A>
+// elements are bookmarks.
+func ParseHTML(r io.Reader) (*safari.Folder, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		root    = safari.NewFolder(rootTitle, nil)
+		stack   = []*safari.Folder{root}
+		pending *safari.Folder // Folder from last <H3>, awaiting its <DL>
+		started bool           // Whether the top-level <DL> has been seen
+	)
+
+	for _, m := range tagRegexp.FindAllStringSubmatch(string(data), -1) {
+		var (
+			closing = m[1] == "/"
+			tag     = strings.ToLower(m[2])
+			attrs   = m[3]
+			text    = strings.TrimSpace(html.UnescapeString(m[4]))
+			parent  = stack[len(stack)-1]
+		)
+
+		switch tag {
+
+		case "h3":
+			if !closing {
+				pending = safari.NewFolder(text, parent)
+			}
+
+		case "dl":
+			if closing {
+				if len(stack) > 1 {
+					stack = stack[:len(stack)-1]
+				}
+			} else if pending != nil {
+				stack = append(stack, pending)
+				pending = nil
+			} else if !started {
+				started = true
+			} else {
+				// List without a heading: keep nesting balanced
+				stack = append(stack, parent)
+			}
+
+		case "a":
+			if closing {
+				continue
+			}
+			hm := hrefRegexp.FindStringSubmatch(attrs)
+			if hm == nil {
+				continue
+			}
+			URL := html.UnescapeString(hm[1] + hm[2] + hm[3])
+			safari.NewBookmark(text, URL, parent)
+		}
+	}
+
+	return root, nil
+}
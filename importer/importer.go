@@ -0,0 +1,59 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package importer reads bookmarks exported from other browsers.
+//
+// Netscape bookmark files (HTML), Chrome's Bookmarks JSON file and Firefox's
+// places.sqlite database are supported. Each is parsed into a tree of
+// safari.Folders and safari.Bookmarks, which can be merged into Safari's
+// bookmarks with safari.Parser.MergeFolder:
+//
+//	src, err := importer.ParseFile("bookmarks.html")
+//	...
+//	p, err := safari.New()
+//	...
+//	f, err := p.AddFolder(p.BookmarksMenu, "Imported")
+//	...
+//	err = p.MergeFolder(f, src)
+//	...
+//	err = p.Save()
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deanishe/go-safari"
+)
+
+// Title of the root Folder returned by the parsers.
+const rootTitle = "Imported"
+
+// ParseFile reads bookmarks from path. The format is determined by the
+// file's extension: ".html" and ".htm" are Netscape bookmark files,
+// ".sqlite" is a Firefox places database and anything else is assumed to
+// be a Chrome Bookmarks file.
+func ParseFile(path string) (*safari.Folder, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+
+	case ".sqlite":
+		return ParseFirefox(path)
+
+	case ".html", ".htm":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseHTML(f)
+
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseChrome(f)
+	}
+}
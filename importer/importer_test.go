@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deanishe/go-safari"
+)
+
+// checkTree verifies the tree returned by all the test files.
+func checkTree(t *testing.T, root *safari.Folder, top string) {
+	if len(root.Folders) != 1 {
+		t.Fatalf("bad no. of top-level folders. Expected=1, Got=%d", len(root.Folders))
+	}
+	bar := root.Folders[0]
+	if bar.Title() != top {
+		t.Errorf("bad folder title. Expected=%q, Got=%q", top, bar.Title())
+	}
+	if len(bar.Bookmarks) != 1 || bar.Bookmarks[0].URL != "https://www.example.com/?a=1&b=2" {
+		t.Fatalf("bad bookmarks in %q: %v", top, bar.Bookmarks)
+	}
+	if bar.Bookmarks[0].Title() != "Example & Co" {
+		t.Errorf("bad bookmark title: %q", bar.Bookmarks[0].Title())
+	}
+	if len(bar.Folders) != 1 || bar.Folders[0].Title() != "Work" {
+		t.Fatalf("bad sub-folders: %v", bar.Folders)
+	}
+	work := bar.Folders[0]
+	if len(work.Bookmarks) != 2 {
+		t.Fatalf("bad no. of bookmarks in Work. Expected=2, Got=%d", len(work.Bookmarks))
+	}
+	bm := work.Bookmarks[1]
+	if bm.Title() != "Wiki" || bm.URL != "https://wiki.example.com/" {
+		t.Errorf("bad bookmark: %q (%s)", bm.Title(), bm.URL)
+	}
+	if len(bm.Ancestors) != 3 || bm.Folder() != work {
+		t.Errorf("bad ancestors: %v", bm.Ancestors)
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	s := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1" PERSONAL_TOOLBAR_FOLDER="true">Favourites</H3>
+    <DL><p>
+        <DT><H3>Work</H3>
+        <DL><p>
+            <DT><A HREF="https://intranet.example.com/" ADD_DATE="1">Intranet</A>
+            <dt><a href='https://wiki.example.com/'>Wiki</a>
+        </DL><p>
+        <DT><A HREF="https://www.example.com/?a=1&amp;b=2">Example &amp; Co</A>
+    </DL><p>
+</DL><p>
+`
+	root, err := ParseHTML(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, root, "Favourites")
+}
+
+func TestParseChrome(t *testing.T) {
+	s := `{
+  "roots": {
+    "bookmark_bar": {"type": "folder", "name": "Bookmarks bar", "children": [
+      {"type": "url", "name": "Example & Co", "url": "https://www.example.com/?a=1&b=2"},
+      {"type": "folder", "name": "Work", "children": [
+        {"type": "url", "name": "Intranet", "url": "https://intranet.example.com/"},
+        {"type": "url", "name": "Wiki", "url": "https://wiki.example.com/"}
+      ]}
+    ]},
+    "other": {"type": "folder", "name": "Other bookmarks", "children": []},
+    "synced": {"type": "folder", "name": "Mobile bookmarks", "children": []}
+  },
+  "version": 1
+}`
+	root, err := ParseChrome(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, root, "Bookmarks Bar")
+}
+
+func TestParseFirefox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "places.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := []string{
+		`CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url LONGVARCHAR, title LONGVARCHAR)`,
+		`CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, type INTEGER, fk INTEGER DEFAULT NULL,
+			parent INTEGER, position INTEGER, title LONGVARCHAR, guid TEXT)`,
+		`INSERT INTO moz_places VALUES (1, 'https://www.example.com/?a=1&b=2', 'Example'),
+			(2, 'https://intranet.example.com/', 'Intranet'), (3, 'https://wiki.example.com/', 'Wiki'),
+			(4, 'place:sort=8', 'Most Visited')`,
+		`INSERT INTO moz_bookmarks VALUES
+			(1, 2, NULL, 0, 0, '', 'root________'),
+			(2, 2, NULL, 1, 0, 'menu', 'menu________'),
+			(3, 2, NULL, 1, 1, 'toolbar', 'toolbar_____'),
+			(4, 2, NULL, 1, 2, 'tags', 'tags________'),
+			(5, 2, NULL, 1, 3, 'unfiled', 'unfiled_____'),
+			(6, 1, 4, 3, 0, 'Most Visited', 'a'),
+			(7, 2, NULL, 3, 2, 'Work', 'b'),
+			(8, 1, 1, 3, 1, 'Example & Co', 'c'),
+			(9, 1, 3, 7, 1, 'Wiki', 'd'),
+			(10, 1, 2, 7, 0, 'Intranet', 'e'),
+			(11, 3, NULL, 3, 3, '', 'f')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	root, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, root, "Bookmarks Toolbar")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseFirefoxContext(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected=%v, Got=%v", context.Canceled, err)
+	}
+}
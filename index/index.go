@@ -0,0 +1,551 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package index provides a full-text index of Safari's bookmarks, Reading
+// List and history.
+//
+// The index is a separate SQLite database owned by this package, so
+// searching it is much faster than scanning bookmarks or running LIKE
+// queries against Safari's History.db. Call Refresh before searching to
+// update the index: only sources whose files have changed since the last
+// refresh are re-indexed. Bookmarks are re-indexed in full, but only
+// history visited since the last refresh is added.
+//
+// The index uses SQLite's FTS5 extension if it is compiled in and falls
+// back to FTS4 otherwise. go-sqlite3 only includes FTS5 when built with
+// the sqlite_fts5 tag:
+//
+//     go build -tags sqlite_fts5
+//
+// Build with the tag for the fastest queries. Results are ordered by
+// relevance with either module: FTS5 ranks them with BM25, and with FTS4
+// they're ranked by how often each word occurs in an item relative to
+// the whole index. In both cases, SQLite ranks and limits the results.
+package index
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+
+	safari "github.com/deanishe/go-safari"
+	"github.com/deanishe/go-safari/history"
+	"github.com/deanishe/go-safari/internal/errs"
+)
+
+// Version of the index schema. If it changes, the index is rebuilt.
+const schemaVersion = 2
+
+// Visits this long before the most recent indexed visit are indexed again
+// on refresh, as Safari sets a visit's title after the page has loaded.
+const historyOverlap = time.Hour
+
+// Name of the SQLite driver that provides the fts4_rank function.
+const driverName = "sqlite3_safari_index"
+
+var registerDriver sync.Once
+
+var (
+	// DefaultIndexPath is where the index is stored by default.
+	DefaultIndexPath = filepath.Join(os.Getenv("HOME"), "Library/Caches/net.deanishe.go-safari/index.db")
+)
+
+// Errors returned by the package. They are the same values as those
+// returned by package safari. Use errors.Is to check for them.
+var (
+	ErrNotFound          = errs.ErrNotFound
+	ErrPermissionDenied  = errs.ErrPermissionDenied
+	ErrUnsupportedSchema = errs.ErrUnsupportedSchema
+)
+
+// Source is where an indexed Item came from.
+type Source string
+
+// Valid Sources.
+const (
+	SourceBookmarks   Source = "bookmarks"
+	SourceReadingList Source = "readinglist"
+	SourceHistory     Source = "history"
+)
+
+// OpenError is returned when an index database can't be opened.
+type OpenError = errs.OpenError
+
+// Item is a search result.
+type Item struct {
+	Source  Source
+	UID     string // UID of bookmark or Reading List item. Empty for history.
+	Title   string
+	URL     string
+	Folder  string // Path of bookmark's folder, e.g. "Favorites/Work"
+	Preview string // Preview text of Reading List item
+}
+
+// Index is a full-text index of Safari data.
+type Index struct {
+	DB *sql.DB
+	// Bookmarks.plist to index bookmarks and Reading List from.
+	// Set to "" to not index them.
+	BookmarksPath string
+	// History.db to index history from. Set to "" to not index history.
+	HistoryPath string
+
+	module string // SQLite full-text module: "fts5" or "fts4"
+}
+
+// Open opens the index database at path, creating it if necessary.
+// BookmarksPath and HistoryPath are set to the default locations of
+// Safari's files. It returns an *OpenError if the index can't be opened.
+func Open(path string) (*Index, error) {
+	return OpenContext(context.Background(), path)
+}
+
+// OpenContext is like Open, but aborts if ctx is cancelled.
+func OpenContext(ctx context.Context, path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, &OpenError{Path: path, Err: errs.File(err)}
+	}
+	registerDriver.Do(func() {
+		sql.Register(driverName, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("fts4_rank", fts4Score, true)
+			},
+		})
+	})
+	db, err := sql.Open(driverName, fmt.Sprintf("file:%s?_timeout=9999999&_journal=WAL", path))
+	if err != nil {
+		return nil, &OpenError{Path: path, Err: err}
+	}
+
+	ix := &Index{
+		DB:            db,
+		BookmarksPath: safari.DefaultBookmarksPath,
+		HistoryPath:   history.DefaultHistoryPath,
+	}
+	if err := ix.init(ctx); err != nil {
+		db.Close()
+		return nil, &OpenError{Path: path, Err: err}
+	}
+	return ix, nil
+}
+
+// Close closes the index database.
+func (ix *Index) Close() error { return ix.DB.Close() }
+
+// init creates the index tables if they don't exist or were created by
+// a different schema version or full-text module.
+func (ix *Index) init(ctx context.Context) error {
+	var fts5 bool
+	if err := ix.DB.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return errs.SQL(err)
+	}
+	ix.module = "fts4"
+	if fts5 {
+		ix.module = "fts5"
+	}
+
+	var (
+		want = fmt.Sprintf("%s/%d", ix.module, schemaVersion)
+		have string
+	)
+	// Only a missing table or row means the index is new. Other errors,
+	// e.g. a locked database, mustn't cause it to be wiped.
+	var n int
+	err := ix.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`).Scan(&n)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	if n > 0 {
+		err := ix.DB.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'schema'`).Scan(&have)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("error reading index schema: %w", errs.SQL(err))
+		}
+	}
+	if have == want {
+		return nil
+	}
+
+	stmts := []string{
+		`DROP TABLE IF EXISTS items`,
+		`DROP TABLE IF EXISTS sources`,
+		`DROP TABLE IF EXISTS meta`,
+		`DROP TABLE IF EXISTS history_urls`,
+		`CREATE TABLE meta (key TEXT PRIMARY KEY, value TEXT)`,
+		`CREATE TABLE sources (name TEXT PRIMARY KEY, mtime INTEGER NOT NULL)`,
+		// rowids of history items, so they can be replaced without
+		// scanning the full-text table
+		`CREATE TABLE history_urls (url TEXT PRIMARY KEY, item INTEGER NOT NULL)`,
+	}
+	if fts5 {
+		stmts = append(stmts, `CREATE VIRTUAL TABLE items USING fts5(
+			source UNINDEXED, uid UNINDEXED, title, url, folder, preview,
+			tokenize = 'unicode61 remove_diacritics 1')`)
+	} else {
+		stmts = append(stmts, `CREATE VIRTUAL TABLE items USING fts4(
+			source, uid, title, url, folder, preview,
+			notindexed=source, notindexed=uid, tokenize=unicode61)`)
+	}
+
+	tx, err := ix.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	defer tx.Rollback()
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			return fmt.Errorf("error running query:%s error: %w", s, errs.SQL(err))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO meta (key, value) VALUES ('schema', ?)`, want); err != nil {
+		return errs.SQL(err)
+	}
+	return errs.SQL(tx.Commit())
+}
+
+// Refresh re-indexes bookmarks and history if their files have changed
+// since the last refresh.
+func (ix *Index) Refresh() error {
+	return ix.RefreshContext(context.Background())
+}
+
+// RefreshContext is like Refresh, but aborts if ctx is cancelled. If the
+// refresh of a source is aborted, its previous contents are kept.
+func (ix *Index) RefreshContext(ctx context.Context) error {
+	if ix.BookmarksPath != "" {
+		err := ix.refresh(ctx, "bookmarks", []string{ix.BookmarksPath}, ix.updateBookmarks)
+		if err != nil {
+			return err
+		}
+	}
+	if ix.HistoryPath != "" {
+		// Safari writes to the WAL file, not the database
+		err := ix.refresh(ctx, "history", []string{ix.HistoryPath, ix.HistoryPath + "-wal"}, ix.updateHistory)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refresh calls update to re-index a source if the latest modification time
+// of paths has changed. The first path must exist. update is called in a
+// transaction, which is rolled back if it fails.
+func (ix *Index) refresh(ctx context.Context, name string, paths []string,
+	update func(context.Context, *sql.Tx) error) error {
+	mtime, err := modTime(paths)
+	if err != nil {
+		return err
+	}
+	var indexed int64
+	if err := ix.DB.QueryRowContext(ctx, `SELECT mtime FROM sources WHERE name = ?`, name).Scan(&indexed); err == nil && indexed == mtime {
+		return nil
+	}
+
+	tx, err := ix.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	defer tx.Rollback()
+
+	if err := update(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO sources (name, mtime) VALUES (?, ?)`, name, mtime); err != nil {
+		return errs.SQL(err)
+	}
+	return errs.SQL(tx.Commit())
+}
+
+// updateBookmarks replaces all bookmarks and Reading List items.
+func (ix *Index) updateBookmarks(ctx context.Context, tx *sql.Tx) error {
+	items, err := ix.loadBookmarks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, src := range []Source{SourceBookmarks, SourceReadingList} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE source = ?`, string(src)); err != nil {
+			return errs.SQL(err)
+		}
+	}
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO items (source, uid, title, url, folder, preview) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	defer insert.Close()
+	for _, it := range items {
+		if _, err := insert.ExecContext(ctx, string(it.Source), it.UID, it.Title, it.URL, it.Folder, it.Preview); err != nil {
+			return errs.SQL(err)
+		}
+	}
+	return nil
+}
+
+// loadBookmarks returns Items for all bookmarks and Reading List items.
+func (ix *Index) loadBookmarks(ctx context.Context) ([]*Item, error) {
+	p, err := safari.New(safari.BookmarksPath(ix.BookmarksPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*Item
+	for _, bm := range p.Bookmarks {
+		items = append(items, &Item{
+			Source: SourceBookmarks,
+			UID:    bm.UID(),
+			Title:  bm.Title(),
+			URL:    bm.URL,
+			Folder: folderPath(bm),
+		})
+	}
+	for _, bm := range p.BookmarksRL {
+		it := &Item{
+			Source: SourceReadingList,
+			UID:    bm.UID(),
+			Title:  bm.Title(),
+			URL:    bm.URL,
+		}
+		if bm.ReadingList != nil {
+			it.Preview = bm.ReadingList.PreviewText
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// updateHistory indexes URLs visited since the last refresh, replacing
+// their Items if they were already indexed. The whole history is
+// re-indexed if it's the first refresh or history has shrunk, i.e. items
+// have been removed from it.
+func (ix *Index) updateHistory(ctx context.Context, tx *sql.Tx) error {
+	h, err := history.NewContext(ctx, ix.HistoryPath)
+	if err != nil {
+		return err
+	}
+	defer h.DB.Close()
+
+	var size int64
+	if err := h.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM history_items`).Scan(&size); err != nil {
+		return errs.SQL(err)
+	}
+
+	var (
+		lastVisit, lastSize int64
+		q                   = history.Query{Unique: true}
+	)
+	err = tx.QueryRowContext(ctx, `SELECT
+		(SELECT value FROM meta WHERE key = 'history_last_visit'),
+		(SELECT value FROM meta WHERE key = 'history_size')`).Scan(&lastVisit, &lastSize)
+	full := err != nil || size < lastSize
+	if full {
+		lastVisit = 0
+		for _, s := range []string{`DELETE FROM items WHERE source = 'history'`, `DELETE FROM history_urls`} {
+			if _, err := tx.ExecContext(ctx, s); err != nil {
+				return errs.SQL(err)
+			}
+		}
+	} else {
+		q.Since = time.Unix(0, lastVisit).Add(-historyOverlap)
+	}
+
+	entries, err := h.FindContext(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	var (
+		find   *sql.Stmt
+		remove *sql.Stmt
+	)
+	if !full {
+		if find, err = tx.PrepareContext(ctx, `SELECT item FROM history_urls WHERE url = ?`); err != nil {
+			return errs.SQL(err)
+		}
+		defer find.Close()
+		if remove, err = tx.PrepareContext(ctx, `DELETE FROM items WHERE rowid = ?`); err != nil {
+			return errs.SQL(err)
+		}
+		defer remove.Close()
+	}
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO items (source, uid, title, url, folder, preview) VALUES (?, '', ?, ?, '', '')`)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	defer insert.Close()
+	record, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO history_urls (url, item) VALUES (?, ?)`)
+	if err != nil {
+		return errs.SQL(err)
+	}
+	defer record.Close()
+
+	for _, e := range entries {
+		if !full {
+			var rowid int64
+			err := find.QueryRowContext(ctx, e.URL).Scan(&rowid)
+			if err == nil {
+				_, err = remove.ExecContext(ctx, rowid)
+			}
+			if err != nil && err != sql.ErrNoRows {
+				return errs.SQL(err)
+			}
+		}
+		res, err := insert.ExecContext(ctx, string(SourceHistory), e.Title, e.URL)
+		if err != nil {
+			return errs.SQL(err)
+		}
+		rowid, err := res.LastInsertId()
+		if err != nil {
+			return errs.SQL(err)
+		}
+		if _, err := record.ExecContext(ctx, e.URL, rowid); err != nil {
+			return errs.SQL(err)
+		}
+		if t := e.Time.UnixNano(); t > lastVisit {
+			lastVisit = t
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO meta (key, value) VALUES
+		('history_last_visit', ?), ('history_size', ?)`, lastVisit, size)
+	return errs.SQL(err)
+}
+
+// Search returns up to limit Items matching query, most relevant first.
+// If limit is 0, all matching Items are returned.
+//
+// Each word in query must match the start of a word in an Item's title,
+// URL, folder path or preview text.
+func (ix *Index) Search(query string, limit int) ([]*Item, error) {
+	return ix.SearchContext(context.Background(), query, limit)
+}
+
+// SearchContext is like Search, but aborts if ctx is cancelled.
+func (ix *Index) SearchContext(ctx context.Context, query string, limit int) ([]*Item, error) {
+	match := ix.matchExpr(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+
+	stmt := `SELECT source, uid, title, url, folder, preview FROM items WHERE items MATCH ?`
+	if ix.module == "fts5" {
+		stmt += ` ORDER BY rank LIMIT ?`
+	} else {
+		// FTS4 has no built-in ranking function, so fts4_rank is
+		// registered with each connection in Open
+		stmt += ` ORDER BY fts4_rank(matchinfo(items, 'pcx')) DESC, rowid LIMIT ?`
+	}
+
+	rows, err := ix.DB.QueryContext(ctx, stmt, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error running query:%s error: %w", stmt, errs.SQL(err))
+	}
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		var (
+			it  = &Item{}
+			src string
+		)
+		if err := rows.Scan(&src, &it.UID, &it.Title, &it.URL, &it.Folder, &it.Preview); err != nil {
+			return nil, errs.SQL(err)
+		}
+		it.Source = Source(src)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.SQL(err)
+	}
+	return items, nil
+}
+
+// fts4Score scores a match from the output of FTS4's matchinfo function
+// with format "pcx": the number of phrases and columns, then for each
+// phrase and column, the number of hits in this row, the number of hits
+// in all rows, and the number of rows with hits. Each phrase scores the
+// proportion of its hits in each column that are in this row, so rare
+// words count for more. See https://www.sqlite.org/fts3.html#matchinfo
+func fts4Score(info []byte) float64 {
+	// matchinfo returns native-endian uint32s. Macs are little-endian.
+	n := len(info) / 4
+	if n < 2 {
+		return 0
+	}
+	v := make([]uint32, n)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(info[i*4:])
+	}
+
+	var (
+		phrases, cols = int(v[0]), int(v[1])
+		score         float64
+	)
+	if 2+phrases*cols*3 > n {
+		return 0
+	}
+	for i := 0; i < phrases*cols; i++ {
+		x := v[2+i*3:]
+		if x[0] > 0 && x[1] > 0 {
+			score += float64(x[0]) / float64(x[1])
+		}
+	}
+	return score
+}
+
+// matchExpr converts a user query to a full-text query that matches each
+// word as a prefix. Query syntax in the input is treated as text.
+func (ix *Index) matchExpr(query string) string {
+	var terms []string
+	for _, w := range strings.Fields(query) {
+		w = strings.Replace(w, `"`, "", -1)
+		if w == "" {
+			continue
+		}
+		if ix.module == "fts5" {
+			terms = append(terms, `"`+w+`"*`)
+		} else {
+			terms = append(terms, `"`+w+`*"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// folderPath returns the titles of bm's folders joined with "/".
+func folderPath(bm *safari.Bookmark) string {
+	var titles []string
+	for _, f := range bm.Ancestors {
+		if f.Title() != "" {
+			titles = append(titles, f.Title())
+		}
+	}
+	return strings.Join(titles, "/")
+}
+
+// modTime returns the latest modification time of paths in nanoseconds.
+// Only the first path must exist.
+func modTime(paths []string) (int64, error) {
+	var latest time.Time
+	for i, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			if i > 0 && os.IsNotExist(err) {
+				continue
+			}
+			return 0, errs.File(err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest.UnixNano(), nil
+}
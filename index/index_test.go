@@ -0,0 +1,343 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	safari "github.com/deanishe/go-safari"
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+// testIndex returns a refreshed Index of the fixtures and the fixture directory.
+func testIndex(t *testing.T) (*Index, string, func()) {
+	dir, cleanup := fixtures.Dir(t)
+	ix, err := Open(filepath.Join(dir, "index", "index.db"))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	ix.BookmarksPath = filepath.Join(dir, fixtures.BookmarksFile)
+	ix.HistoryPath = filepath.Join(dir, fixtures.HistoryFile)
+	if err := ix.Refresh(); err != nil {
+		ix.Close()
+		cleanup()
+		t.Fatal(err)
+	}
+	return ix, dir, func() {
+		ix.Close()
+		cleanup()
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	tests := []struct {
+		q       string
+		sources map[Source]int
+	}{
+		{"wiki", map[Source]int{SourceBookmarks: 1, SourceHistory: 2}},
+		{"WIKI home", map[Source]int{SourceHistory: 1}},
+		{"favorites work", map[Source]int{SourceBookmarks: 1}},
+		{"golang.org", map[Source]int{SourceHistory: 1}},
+		{"post", map[Source]int{SourceReadingList: 2}},
+		{"an old", map[Source]int{SourceReadingList: 1}},
+		{`"go`, map[Source]int{SourceHistory: 3}},
+		{"nothing", map[Source]int{}},
+		{"", map[Source]int{}},
+	}
+
+	for _, td := range tests {
+		items, err := ix.Search(td.q, 0)
+		if err != nil {
+			t.Errorf("search for '%s' failed: %v", td.q, err)
+			continue
+		}
+		got := map[Source]int{}
+		for _, it := range items {
+			got[it.Source]++
+		}
+		for _, src := range []Source{SourceBookmarks, SourceReadingList, SourceHistory} {
+			if got[src] != td.sources[src] {
+				t.Errorf("bad no. of %s results for '%s'. Expected=%d, Got=%d", src, td.q, td.sources[src], got[src])
+			}
+		}
+	}
+
+	items, err := ix.Search("wiki", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Errorf("bad no. of results. Expected=1, Got=%d", len(items))
+	}
+
+	items, err = ix.Search("old post", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("bad no. of results. Expected=1, Got=%d", len(items))
+	}
+	if it := items[0]; it.UID != "RL1" || it.Preview != "An old post" || it.URL == "" {
+		t.Errorf("bad Reading List item: %#v", it)
+	}
+
+	items, err = ix.Search("favorites work", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Folder != "Favorites/Work" {
+		t.Errorf("bad bookmark: %#v", items)
+	}
+}
+
+// TestSearchRanking tests that results are ordered by relevance, not the
+// order they were indexed in, with either full-text module.
+func TestSearchRanking(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	for _, it := range []*Item{
+		{Source: SourceHistory, Title: "Notes", URL: "https://notes.example.com/zebra"},
+		{Source: SourceHistory, Title: "Zebra Zebra", URL: "https://zebra.example.com/", Preview: "zebra"},
+		{Source: SourceHistory, Title: "Zebra", URL: "https://animals.example.com/"},
+	} {
+		_, err := ix.DB.Exec(`INSERT INTO items (source, uid, title, url, folder, preview)
+			VALUES (?, '', ?, ?, '', ?)`, it.Source, it.Title, it.URL, it.Preview)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := ix.Search("zebra", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].Title != "Zebra Zebra" {
+		t.Errorf("bad ranking (%s). Expected first=%q, Got=%+v", ix.module, "Zebra Zebra", items)
+	}
+
+	items, err = ix.Search("zebra", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != "Zebra Zebra" {
+		t.Errorf("bad limited ranking (%s). Expected=%q, Got=%+v", ix.module, "Zebra Zebra", items)
+	}
+}
+
+// TestRefresh tests that sources are only re-indexed when their files change.
+func TestRefresh(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	fi, err := os.Stat(ix.BookmarksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := safari.New(safari.BookmarksPath(ix.BookmarksPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddBookmark(p.BookmarksMenu, "Zebra", "https://zebra.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int {
+		items, err := ix.Search("zebra", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items)
+	}
+
+	// Same mtime: not re-indexed
+	if err := os.Chtimes(ix.BookmarksPath, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("unchanged file re-indexed. Expected=0, Got=%d", n)
+	}
+
+	// Newer mtime: re-indexed
+	mtime := fi.ModTime().Add(time.Minute)
+	if err := os.Chtimes(ix.BookmarksPath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("changed file not re-indexed. Expected=1, Got=%d", n)
+	}
+	// Other sources are untouched
+	if items, _ := ix.Search("wiki", 0); len(items) != 3 {
+		t.Errorf("bad no. of results. Expected=3, Got=%d", len(items))
+	}
+}
+
+// TestRefreshHistory tests that only recently-visited history is
+// re-indexed, unless items have been removed from history.
+func TestRefreshHistory(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	db, err := sql.Open("sqlite3", "file:"+ix.HistoryPath+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// update changes history and its mtime, refreshes the index and
+	// returns the number of history results for "zebra"
+	update := func(stmts ...string) int {
+		for _, s := range stmts {
+			if _, err := db.Exec(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mtime := time.Now().Add(time.Minute)
+		if err := os.Chtimes(ix.HistoryPath, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		items, err := ix.Search("zebra", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(items)
+	}
+
+	visitTime := fixtures.HistoryTime.Add(time.Hour).Unix() - 978307200
+	n := update(
+		// New URL
+		`INSERT INTO history_items (id, url, domain_expansion, visit_count, daily_visit_counts,
+			should_recompute_derived_visit_counts, visit_count_score)
+			VALUES (100, 'https://zebra.example.com/', 'zebra.example', 1, x'', 0, 100)`,
+		fmt.Sprintf(`INSERT INTO history_visits (id, history_item, visit_time, title)
+			VALUES (100, 100, %d, 'Zebra')`, visitTime),
+		// Title of recent visit changed
+		`UPDATE history_visits SET title = 'Google Zebra' WHERE id = 1`,
+		// Title of old visit changed: not re-indexed
+		`UPDATE history_visits SET title = 'Start - Zebra' WHERE id = 24`,
+	)
+	if n != 2 {
+		t.Errorf("bad no. of new results. Expected=2, Got=%d", n)
+	}
+	items, err := ix.Search("google", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("bad no. of re-indexed results. Expected=2, Got=%d", len(items))
+	}
+
+	// Item removed: whole history re-indexed
+	n = update(`DELETE FROM history_visits WHERE history_item = 11`, `DELETE FROM history_items WHERE id = 11`)
+	if n != 3 {
+		t.Errorf("bad no. of results after rebuild. Expected=3, Got=%d", n)
+	}
+}
+
+// TestReopen tests that an existing index is reused.
+func TestReopen(t *testing.T) {
+	ix, dir, cleanup := testIndex(t)
+	defer cleanup()
+	ix.Close()
+
+	ix2, err := Open(filepath.Join(dir, "index", "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix2.Close()
+	items, err := ix2.Search("wiki", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Errorf("bad no. of results. Expected=3, Got=%d", len(items))
+	}
+}
+
+// TestOpenBadSchema tests that the index isn't wiped if its schema version
+// can't be read for a reason other than the index being new.
+func TestOpenBadSchema(t *testing.T) {
+	ix, dir, cleanup := testIndex(t)
+	defer cleanup()
+
+	for _, s := range []string{`DROP TABLE meta`, `CREATE TABLE meta (key TEXT)`} {
+		if _, err := ix.DB.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ix.Close()
+
+	if ix2, err := Open(filepath.Join(dir, "index", "index.db")); err == nil {
+		ix2.Close()
+		t.Fatal("opened index with unreadable schema")
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "index", "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&n); err != nil || n == 0 {
+		t.Errorf("index wiped: %d items, %v", n, err)
+	}
+}
+
+func TestMissingSource(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	ix.HistoryPath = "/does/not/exist.db"
+	if err := ix.Refresh(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing source: Expected=ErrNotFound, Got=%v", err)
+	}
+}
+
+func TestRefreshContext(t *testing.T) {
+	ix, _, cleanup := testIndex(t)
+	defer cleanup()
+
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(ix.HistoryPath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ix.RefreshContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected=%v, Got=%v", context.Canceled, err)
+	}
+
+	// Previous contents are kept
+	items, err := ix.Search("wiki", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Errorf("bad no. of results. Expected=3, Got=%d", len(items))
+	}
+}
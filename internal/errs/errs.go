@@ -0,0 +1,144 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package errs defines the error values shared by go-safari's packages and
+// maps low-level errors from the filesystem, SQLite and osascript onto them.
+//
+// The packages re-export the values, so errors.Is(err, history.ErrNotFound)
+// and errors.Is(err, safari.ErrNotFound) are equivalent.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Kinds of error.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrPermissionDenied  = errors.New("permission denied (does the program have Full Disk Access and permission to automate Safari?)")
+	ErrSafariNotRunning  = errors.New("Safari is not running")
+	ErrNoSuchWindow      = errors.New("no such window")
+	ErrNoSuchTab         = errors.New("no such tab")
+	ErrJSDisabled        = errors.New(`JavaScript from Apple Events is disabled (enable "Allow JavaScript from Apple Events" in Safari's Develop menu)`)
+	ErrUnsupportedSchema = errors.New("unsupported database schema")
+)
+
+// Error is an error of a specific kind. errors.Is(err, kind) returns true
+// for an Error of that kind.
+type Error struct {
+	Kind error // One of the Err* values
+	Err  error // Underlying error
+}
+
+// Error implements error.
+func (e *Error) Error() string { return e.Kind.Error() + ": " + e.Err.Error() }
+
+// Is returns true if target is e's Kind.
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// OpenError is returned when a database can't be opened. Packages history,
+// cloud and index export it under the same name.
+type OpenError struct {
+	Path string // Path to database
+	Err  error  // Underlying error
+}
+
+// Error implements error.
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("couldn't open database %s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *OpenError) Unwrap() error { return e.Err }
+
+// Wrap returns an Error of kind wrapping err. It returns nil if err is nil.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{kind, err}
+}
+
+// File maps errors from opening or reading files onto ErrNotFound and
+// ErrPermissionDenied. Other errors are returned unchanged.
+//
+// On Mojave and later, reading Safari's data files without Full Disk
+// Access fails with EPERM.
+func File(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return Wrap(ErrNotFound, err)
+	case os.IsPermission(err):
+		return Wrap(ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// SQL maps SQLite errors onto ErrPermissionDenied and ErrUnsupportedSchema.
+// Other errors are returned unchanged.
+//
+// A database that can't be opened because of a missing Full Disk Access
+// grant fails with SQLITE_CANTOPEN and a system errno of EPERM or EACCES.
+func SQL(err error) error {
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	switch e.Code {
+	case sqlite3.ErrPerm, sqlite3.ErrAuth:
+		return Wrap(ErrPermissionDenied, err)
+	case sqlite3.ErrCantOpen:
+		if e.SystemErrno == syscall.EPERM || e.SystemErrno == syscall.EACCES {
+			return Wrap(ErrPermissionDenied, err)
+		}
+	case sqlite3.ErrError:
+		msg := err.Error()
+		if strings.Contains(msg, "no such table") || strings.Contains(msg, "no such column") {
+			return Wrap(ErrUnsupportedSchema, err)
+		}
+	}
+	return err
+}
+
+// Messages written to STDERR by osascript and the JXA scripts, and the
+// kind of error they map to.
+var osascriptErrors = []struct {
+	substr string
+	kind   error
+}{
+	{"Safari is not running", ErrSafariNotRunning},
+	{"(-600)", ErrSafariNotRunning},  // Application isn't running
+	{"(-1743)", ErrPermissionDenied}, // Not authorised to send Apple events
+	{"(-1719)", ErrPermissionDenied}, // Assistive access not enabled
+	{"Invalid window", ErrNoSuchWindow},
+	{"Invalid tab", ErrNoSuchTab},
+	{"Allow JavaScript from Apple Events", ErrJSDisabled},
+}
+
+// OSAScript maps the output of a failed osascript command onto
+// ErrSafariNotRunning, ErrPermissionDenied, ErrNoSuchWindow, ErrNoSuchTab
+// and ErrJSDisabled. Other errors are returned unchanged.
+func OSAScript(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for _, oe := range osascriptErrors {
+		if strings.Contains(msg, oe.substr) {
+			return Wrap(oe.kind, err)
+		}
+	}
+	return err
+}
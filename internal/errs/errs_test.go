@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package errs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestFile(t *testing.T) {
+	_, err := os.Open("/does/not/exist")
+	if err := File(err); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing file: Expected=ErrNotFound, Got=%v", err)
+	}
+	if err := File(&os.PathError{Op: "open", Path: "x", Err: os.ErrPermission}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("EPERM: Expected=ErrPermissionDenied, Got=%v", err)
+	}
+	if File(nil) != nil {
+		t.Error("nil error wrapped")
+	}
+}
+
+func TestSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{"SELECT * FROM nope", "SELECT name FROM items"} {
+		_, err := db.Query(q)
+		if err := SQL(err); !errors.Is(err, ErrUnsupportedSchema) {
+			t.Errorf("%q: Expected=ErrUnsupportedSchema, Got=%v", q, err)
+		}
+	}
+
+	for _, errno := range []syscall.Errno{syscall.EPERM, syscall.EACCES} {
+		err := sqlite3.Error{Code: sqlite3.ErrCantOpen, SystemErrno: errno}
+		if err := SQL(err); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%v: Expected=ErrPermissionDenied, Got=%v", errno, err)
+		}
+	}
+	cantOpen := sqlite3.Error{Code: sqlite3.ErrCantOpen, SystemErrno: syscall.EISDIR}
+	if err := SQL(cantOpen); errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("EISDIR mapped to ErrPermissionDenied")
+	}
+
+	other := errors.New("other")
+	if SQL(other) != other {
+		t.Error("non-SQLite error changed")
+	}
+}
+
+func TestOSAScript(t *testing.T) {
+	tests := []struct {
+		stderr string
+		x      error
+	}{
+		{"Safari is not running", ErrSafariNotRunning},
+		{"execution error: Safari got an error: Application isn't running. (-600)", ErrSafariNotRunning},
+		{"execution error: Not authorized to send Apple events to Safari. (-1743)", ErrPermissionDenied},
+		{"Invalid window: 4", ErrNoSuchWindow},
+		{"Invalid tab for window 1: 9", ErrNoSuchTab},
+		{"You must enable 'Allow JavaScript from Apple Events' in the Developer section of Safari Settings to use 'do JavaScript'.", ErrJSDisabled},
+		{"something else", nil},
+	}
+
+	for _, td := range tests {
+		in := fmt.Errorf("exit status 1: %s", td.stderr)
+		err := OSAScript(in)
+		if td.x == nil {
+			if err != in {
+				t.Errorf("%q: error changed: %v", td.stderr, err)
+			}
+			continue
+		}
+		if !errors.Is(err, td.x) {
+			t.Errorf("%q: Expected=%v, Got=%v", td.stderr, td.x, err)
+		}
+		if errors.Unwrap(err) != in {
+			t.Errorf("%q: underlying error lost", td.stderr)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package fixtures
+
+import (
+	"io/ioutil"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Bookmarks returns the contents of a synthetic Bookmarks.plist.
+//
+// The Bookmarks Bar contains bookmark BM1 (with an extra "Sync" key that
+// Safari's parser doesn't know about), bookmarklet BM3 and folder WORK, which
+// contains bookmark BM2. The Bookmarks Menu (MENU) is empty. The Reading
+// List (RL) contains RL1, added 60 days ago and read 30 days ago, and RL2,
+// added yesterday and unread.
+func Bookmarks() map[string]interface{} {
+	now := time.Now().UTC()
+	bm1 := leaf("BM1", "Example", "https://www.example.com/")
+	bm1["Sync"] = map[string]interface{}{"Key": "preserve me"}
+
+	return map[string]interface{}{
+		"WebBookmarkFileVersion": uint64(1),
+		"WebBookmarkType":        "WebBookmarkTypeList",
+		"WebBookmarkUUID":        "ROOT",
+		"Children": []interface{}{
+			map[string]interface{}{
+				"WebBookmarkType": "WebBookmarkTypeProxy",
+				"Title":           "History",
+				"WebBookmarkUUID": "HISTORY",
+			},
+			map[string]interface{}{
+				"WebBookmarkType": "WebBookmarkTypeList",
+				"Title":           "BookmarksBar",
+				"WebBookmarkUUID": "BAR",
+				"Children": []interface{}{
+					bm1,
+					leaf("BM3", "Bookmarklet", "javascript:alert(%22hello%22)"),
+					map[string]interface{}{
+						"WebBookmarkType": "WebBookmarkTypeList",
+						"Title":           "Work",
+						"WebBookmarkUUID": "WORK",
+						"Children": []interface{}{
+							leaf("BM2", "Wiki", "https://wiki.example.com/"),
+						},
+					},
+				},
+			},
+			map[string]interface{}{
+				"WebBookmarkType": "WebBookmarkTypeList",
+				"Title":           "BookmarksMenu",
+				"WebBookmarkUUID": "MENU",
+				"Children":        []interface{}{},
+			},
+			map[string]interface{}{
+				"WebBookmarkType": "WebBookmarkTypeList",
+				"Title":           "com.apple.ReadingList",
+				"WebBookmarkUUID": "RL",
+				"Children": []interface{}{
+					readingListItem("RL1", "Old Post", "https://blog.example.com/old", "An old post",
+						now.Add(-60*24*time.Hour), now.Add(-30*24*time.Hour)),
+					readingListItem("RL2", "New Post", "https://blog.example.com/new", "A new post",
+						now.Add(-24*time.Hour), time.Time{}),
+				},
+			},
+		},
+	}
+}
+
+// leaf returns a bookmark.
+func leaf(uid, title, URL string) map[string]interface{} {
+	d := map[string]interface{}{
+		"WebBookmarkType": "WebBookmarkTypeLeaf",
+		"WebBookmarkUUID": uid,
+		"URLString":       URL,
+		"URIDictionary":   map[string]interface{}{"title": title},
+	}
+	return d
+}
+
+// readingListItem returns a Reading List bookmark. If viewed is zero,
+// the item is unread.
+func readingListItem(uid, title, URL, preview string, added, viewed time.Time) map[string]interface{} {
+	rl := map[string]interface{}{
+		"DateAdded":       added,
+		"DateLastFetched": added,
+		"PreviewText":     preview,
+	}
+	if !viewed.IsZero() {
+		rl["DateLastViewed"] = viewed
+	}
+	d := leaf(uid, title, URL)
+	d["ReadingList"] = rl
+	return d
+}
+
+// WriteBookmarks writes a synthetic Bookmarks.plist to path. If binary is
+// true, the file is a binary plist (as written by Safari), otherwise it's XML.
+func WriteBookmarks(path string, binary bool) error {
+	format := plist.XMLFormat
+	if binary {
+		format = plist.BinaryFormat
+	}
+	data, err := plist.MarshalIndent(Bookmarks(), format, "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
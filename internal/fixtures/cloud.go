@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package fixtures
+
+import (
+	"bytes"
+	"compress/zlib"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Schema of Safari's CloudTabs.db (Safari 12). Safari uses WAL journalling.
+var cloudTabsSchema = []string{
+	`PRAGMA journal_mode=WAL`,
+	`CREATE TABLE cloud_tab_devices (
+		device_uuid TEXT PRIMARY KEY NOT NULL,
+		system_fields BLOB NOT NULL,
+		device_name TEXT,
+		has_duplicate_device_name BOOL NOT NULL DEFAULT 0,
+		is_ephemeral_device BOOL NOT NULL DEFAULT 0,
+		last_modified REAL NOT NULL DEFAULT 0)`,
+	`CREATE TABLE cloud_tabs (
+		tab_uuid TEXT PRIMARY KEY NOT NULL,
+		system_fields BLOB NOT NULL,
+		device_uuid TEXT NOT NULL REFERENCES cloud_tab_devices(device_uuid) ON DELETE CASCADE,
+		position BLOB NOT NULL,
+		title TEXT,
+		url TEXT NOT NULL,
+		is_showing_reader BOOL NOT NULL DEFAULT 0,
+		is_pinned BOOL NOT NULL DEFAULT 0,
+		reader_scroll_position_page_index INT NOT NULL DEFAULT 0,
+		scene_id TEXT)`,
+	`CREATE TABLE metadata (key TEXT NOT NULL UNIQUE, value)`,
+	`INSERT INTO metadata VALUES ('version', 3)`,
+}
+
+// LocalDevice is the name of the device that the CloudTabs.db fixture
+// belongs to. Its tabs should be ignored.
+const LocalDevice = "This Mac"
+
+// CloudTab is a row in cloud_tabs.
+type CloudTab struct {
+	Device    string
+	Title     string
+	URL       string
+	SortValue int
+}
+
+// CloudTabs are the contents of the CloudTabs.db fixture, in the order
+// they should be returned (i.e. sorted by device and sort value), followed
+// by the tabs of LocalDevice.
+var CloudTabs = []CloudTab{
+	{"iPad", "Apple", "https://www.apple.com/", 1},
+	{"iPad", "Example", "https://www.example.com/", 2},
+	{"iPhone", "Alfred", "https://www.alfredapp.com/", 0},
+	{"iPhone", "Go", "https://golang.org/", 5},
+	{"iPhone", "Wiki", "https://wiki.example.com/", 10},
+	{LocalDevice, "Local", "https://local.example.com/", 0},
+}
+
+// positionBlob returns a zlib-compressed position blob.
+func positionBlob(sortValue int, device string) ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"sortValues": []map[string]interface{}{
+			{"changeID": 1, "sortValue": sortValue, "deviceIdentifier": device},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w := zlib.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteCloudTabs writes a synthetic CloudTabs.db to path.
+func WriteCloudTabs(path string) error {
+	os.Remove(path)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, s := range cloudTabsSchema {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+
+	devices := map[string]string{}
+	// Insert in reverse order to ensure results are sorted
+	for i := len(CloudTabs) - 1; i >= 0; i-- {
+		ct := CloudTabs[i]
+		uuid, ok := devices[ct.Device]
+		if !ok {
+			uuid = fmt.Sprintf("DEVICE-%d", len(devices)+1)
+			devices[ct.Device] = uuid
+			_, err := db.Exec(`INSERT INTO cloud_tab_devices (device_uuid, system_fields, device_name)
+				VALUES (?, x'', ?)`, uuid, ct.Device)
+			if err != nil {
+				return err
+			}
+		}
+
+		pos, err := positionBlob(ct.SortValue, uuid)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`INSERT INTO cloud_tabs (tab_uuid, system_fields, device_uuid, position, title, url)
+			VALUES (?, x'', ?, ?, ?, ?)`, fmt.Sprintf("TAB-%d", i+1), uuid, pos, ct.Title, ct.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package fixtures generates synthetic Safari data files for tests.
+//
+// The files match the format and schema of Safari's own Bookmarks.plist,
+// History.db and CloudTabs.db, so the library can be tested on machines
+// without Safari (or without access to the user's Safari data).
+package fixtures
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Names of the files created by Dir.
+const (
+	BookmarksFile    = "Bookmarks.plist"
+	BookmarksXMLFile = "Bookmarks.xml.plist"
+	HistoryFile      = "History.db"
+	CloudTabsFile    = "CloudTabs.db"
+)
+
+// Dir creates a temporary directory containing all the fixture files and
+// returns its path and a function that deletes it.
+func Dir(t testing.TB) (string, func()) {
+	dir, err := ioutil.TempDir("", "go-safari-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err := WriteAll(dir); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return dir, cleanup
+}
+
+// WriteAll writes all the fixture files to directory dir.
+func WriteAll(dir string) error {
+	if err := WriteBookmarks(filepath.Join(dir, BookmarksFile), true); err != nil {
+		return err
+	}
+	if err := WriteBookmarks(filepath.Join(dir, BookmarksXMLFile), false); err != nil {
+		return err
+	}
+	if err := WriteHistory(filepath.Join(dir, HistoryFile)); err != nil {
+		return err
+	}
+	return WriteCloudTabs(filepath.Join(dir, CloudTabsFile))
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package fixtures
+
+import (
+	"database/sql"
+	"os"
+	"time"
+
+	// sqlite3 registers itself with sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Schema of Safari's History.db (Safari 12). Safari uses WAL journalling.
+var historySchema = []string{
+	`PRAGMA journal_mode=WAL`,
+	`CREATE TABLE history_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL UNIQUE,
+		domain_expansion TEXT NULL,
+		visit_count INTEGER NOT NULL,
+		daily_visit_counts BLOB NOT NULL,
+		weekly_visit_counts BLOB NULL,
+		autocomplete_triggers BLOB NULL,
+		should_recompute_derived_visit_counts INTEGER NOT NULL,
+		visit_count_score INTEGER NOT NULL)`,
+	`CREATE TABLE history_visits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		history_item INTEGER NOT NULL REFERENCES history_items(id) ON DELETE CASCADE,
+		visit_time REAL NOT NULL,
+		title TEXT NULL,
+		load_successful BOOLEAN NOT NULL DEFAULT 1,
+		http_non_get BOOLEAN NOT NULL DEFAULT 0,
+		synthesized BOOLEAN NOT NULL DEFAULT 0,
+		redirect_source INTEGER NULL UNIQUE REFERENCES history_visits(id) ON DELETE CASCADE,
+		redirect_destination INTEGER NULL UNIQUE REFERENCES history_visits(id) ON DELETE CASCADE,
+		origin INTEGER NOT NULL DEFAULT 0,
+		generation INTEGER NOT NULL DEFAULT 0,
+		attributes INTEGER NOT NULL DEFAULT 0,
+		score INTEGER NOT NULL DEFAULT 0)`,
+	`CREATE INDEX history_visits__last_visit ON history_visits (history_item, visit_time DESC, synthesized ASC)`,
+	`CREATE INDEX history_visits__origin ON history_visits (origin, generation)`,
+	`CREATE TABLE metadata (key TEXT NOT NULL UNIQUE, value)`,
+	`INSERT INTO metadata VALUES ('version', 10)`,
+}
+
+// HistoryTime is the time of the most recent visit in the History.db fixture.
+// Other visits are a whole number of hours before it.
+var HistoryTime = time.Date(2019, 2, 1, 12, 0, 0, 0, time.UTC)
+
+// HistoryItem is a row in history_items.
+type HistoryItem struct {
+	ID              int64
+	URL             string
+	DomainExpansion string // Empty means NULL
+	Visits          []HistoryVisit
+}
+
+// HistoryVisit is a row in history_visits.
+type HistoryVisit struct {
+	ID         int64
+	HoursAgo   int // Visit time is HistoryTime minus this many hours
+	Title      string
+	RedirectTo int64 // ID of visit this visit redirected to
+}
+
+// HistoryItems are the contents of the History.db fixture.
+//
+// Visit 17 (bit.ly) redirects to visit 18 (t.co), which redirects to
+// visit 19 (golang.org). The ftp:// item and the item without a title
+// should be ignored by queries. Safari doesn't set domain_expansion for
+// single-label hosts, so it's NULL for the http://intranet/ item.
+var HistoryItems = []HistoryItem{
+	{1, "https://www.google.com/", "google", []HistoryVisit{
+		{1, 0, "Google", 0}, {2, 5, "Google", 0}, {3, 30, "Google", 0},
+		{4, 200, "Google", 0}, {5, 400, "Google", 0},
+	}},
+	{2, "https://www.google.com/search?q=golang", "google", []HistoryVisit{
+		{6, 1, "golang - Google Search", 0},
+	}},
+	{3, "https://www.alfredapp.com/", "alfredapp", []HistoryVisit{
+		{7, 2, "Alfred - Productivity App for macOS", 0},
+		{8, 50, "Alfred - Productivity App for macOS", 0},
+		{9, 300, "Alfred - Productivity App for macOS", 0},
+	}},
+	{4, "https://wiki.example.com/Home", "wiki.example", []HistoryVisit{
+		{10, 3, "Home - Wiki", 0}, {11, 26, "Home - Wiki", 0},
+		{12, 100, "Home - Wiki", 0}, {13, 240, "Home - Wiki", 0},
+	}},
+	{5, "https://wiki.example.com/Projects", "wiki.example", []HistoryVisit{
+		{14, 4, "Projects - Wiki", 0}, {15, 170, "Projects - Wiki", 0},
+	}},
+	{6, "http://news.example.com/", "news.example", []HistoryVisit{
+		{16, 6, "News", 0},
+	}},
+	{7, "https://bit.ly/golang", "bit", []HistoryVisit{
+		{17, 7, "", 18},
+	}},
+	{8, "https://t.co/golang", "t", []HistoryVisit{
+		{18, 7, "", 19},
+	}},
+	{9, "https://golang.org/", "golang", []HistoryVisit{
+		{19, 7, "The Go Programming Language", 0},
+		{20, 8, "The Go Programming Language", 0},
+		{21, 1000, "The Go Programming Language", 0},
+	}},
+	{10, "ftp://files.example.com/", "files.example", []HistoryVisit{
+		{22, 9, "Files", 0},
+	}},
+	{11, "https://untitled.example.com/", "untitled.example", []HistoryVisit{
+		{23, 10, "", 0},
+	}},
+	{12, "http://intranet/Start", "", []HistoryVisit{
+		{24, 500, "Start - Intranet", 0},
+	}},
+}
+
+// nsDate converts a time to seconds since the NSDate epoch (2001-01-01).
+func nsDate(t time.Time) float64 {
+	return float64(t.Unix() - 978307200)
+}
+
+// WriteHistory writes a synthetic History.db to path.
+func WriteHistory(path string) error {
+	os.Remove(path)
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, s := range historySchema {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+
+	redirectFrom := map[int64]int64{}
+	for _, it := range HistoryItems {
+		for _, v := range it.Visits {
+			if v.RedirectTo != 0 {
+				redirectFrom[v.RedirectTo] = v.ID
+			}
+		}
+	}
+
+	for _, it := range HistoryItems {
+		var domain interface{}
+		if it.DomainExpansion != "" {
+			domain = it.DomainExpansion
+		}
+		_, err := db.Exec(`INSERT INTO history_items
+			(id, url, domain_expansion, visit_count, daily_visit_counts,
+				should_recompute_derived_visit_counts, visit_count_score)
+			VALUES (?, ?, ?, ?, x'', 0, ?)`,
+			it.ID, it.URL, domain, len(it.Visits), len(it.Visits)*100)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range it.Visits {
+			var title, src, dst interface{}
+			if v.Title != "" {
+				title = v.Title
+			}
+			if id := redirectFrom[v.ID]; id != 0 {
+				src = id
+			}
+			if v.RedirectTo != 0 {
+				dst = v.RedirectTo
+			}
+			t := HistoryTime.Add(-time.Duration(v.HoursAgo) * time.Hour)
+			_, err := db.Exec(`INSERT INTO history_visits
+				(id, history_item, visit_time, title, redirect_source, redirect_destination)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				v.ID, it.ID, nsDate(t), title, src, dst)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
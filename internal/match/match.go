@@ -0,0 +1,29 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package match provides the text matching shared by go-safari's ranked
+// searches.
+package match
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words splits s into lowercase words at any character that isn't a
+// letter or number.
+func Words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// HasPrefix returns true if any of words starts with s.
+func HasPrefix(words []string, s string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, s) {
+			return true
+		}
+	}
+	return false
+}
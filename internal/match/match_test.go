@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package match
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		in, x string
+	}{
+		{"", ""},
+		{"Go", "go"},
+		{"The Go Programming Language", "the go programming language"},
+		{"golang - Google Search", "golang google search"},
+		{"Café/Menu (2019)", "café menu 2019"},
+	}
+	for _, td := range tests {
+		if s := strings.Join(Words(td.in), " "); s != td.x {
+			t.Errorf("Words(%q): Expected=%q, Got=%q", td.in, td.x, s)
+		}
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	words := []string{"golang", "google", "search"}
+	tests := []struct {
+		s string
+		x bool
+	}{
+		{"go", true},
+		{"sea", true},
+		{"lang", false},
+		{"", true},
+	}
+	for _, td := range tests {
+		if v := HasPrefix(words, td.s); v != td.x {
+			t.Errorf("HasPrefix(%q): Expected=%v, Got=%v", td.s, td.x, v)
+		}
+	}
+}
@@ -13,32 +13,57 @@ const (
 	// jsGetCurrentTab -> JSON
 	jsGetCurrentTab = `
 
-// ObjC.import('stdlib')
+ObjC.import('stdlib')
 
 var safari = Application('Safari')
 safari.includeStandardAdditions = true
 
 
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
 function getCurrentTab() {
   var winIdx = 1,
-    tab = safari.windows[0].currentTab,
+    win = safari.windows[0],
+    tab = win.currentTab,
     tabIdx = tab.index(),
     title = tab.name(),
     url = tab.url()
   console.log('win=1, tab=' + tabIdx + ', title="' + title + '", url=' + url)
-  return {title: title, url: url, index: tabIdx, windowIndex: 1}
+  return {id: tabID(tab), title: title, url: url, index: tabIdx, windowIndex: 1, windowID: win.id(), active: true}
 }
 
 function run(argv) {
+  if (!Application('Safari').running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
   return JSON.stringify(getCurrentTab())
 }
 `
 	// jsGetTabs -> JSON
 	jsGetTabs = `
 
-// ObjC.import('stdlib')
+ObjC.import('stdlib')
 // ObjC.import('stdio')
 
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
 function getWindows() {
 
   var safari = Application('Safari')
@@ -48,8 +73,8 @@ function getWindows() {
   var wins = safari.windows
 
   for (i=0; i<wins.length; i++) {
-    var data = {'index': i+1, 'tabs': []},
-      w = wins[i],
+    var w = wins[i],
+      data = {'index': i+1, 'id': w.id(), 'tabs': []},
       tabs = w.tabs
 
     // Ignore non-browser windows
@@ -65,10 +90,12 @@ function getWindows() {
     for (j=0; j<tabs.length; j++) {
       var t = tabs[j]
       data.tabs.push({
+        'id': tabID(t),
         'title': t.name(),
         'url': t.url(),
         'index': j+1,
         'windowIndex': i+1,
+        'windowID': data['id'],
 	'active': j+1 === data['activeTab']
       })
     }
@@ -79,6 +106,10 @@ function getWindows() {
 }
 
 function run(argv) {
+  if (!Application('Safari').running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
   return JSON.stringify(getWindows())
 }
 `
@@ -231,6 +262,11 @@ function run(argv) {
     $.exit(0);
   }
 
+  if (!app.running()) {
+    console.log('Safari is not running');
+    $.exit(1);
+  }
+
   // Validate arguments
   if (!whats.contains(what)) {
     console.log('Invalid target: ' + what);
@@ -336,6 +372,11 @@ function run(argv) {
     $.exit(1)
   }
 
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
   winIdx = parseInt(argv[0], 10)
   tabIdx = parseInt(argv[1], 10)
   js = argv[2]
@@ -354,5 +395,580 @@ function run(argv) {
   runJSInTab(winIdx, tabIdx, js)
 }
 
+`
+
+	// jsEvalJavaScript <win> <tab> <expression> -> JSON | Evaluate JavaScript
+	// in a tab and return {"value": <result>} or {"error": {"name": <name>,
+	// "message": <message>}}
+	jsEvalJavaScript = `
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// wrap <js> | Wrap expression js in a function that returns its value or
+// the exception it throws as JSON
+function wrap(js) {
+  return '(function() {\n' +
+    '  try {\n' +
+    '    var value = (\n' + js + '\n)\n' +
+    '    return JSON.stringify({value: value === undefined ? null : value})\n' +
+    '  }\n' +
+    '  catch (e) {\n' +
+    '    return JSON.stringify({error: {name: String(e && e.name || "Error"), message: String(e && e.message || e)}})\n' +
+    '  }\n' +
+    '})()'
+}
+
+// evalJSInTab <win> <tab> <js> | Evaluate JavaScript in tab
+function evalJSInTab(winIdx, tabIdx, js) {
+
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  try {
+    var tab = win.tabs[tabIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+
+  try {
+    var out = safari.doJavaScript(wrap(js), {in: tab})
+  }
+  catch (e) {
+    // Probably "Allow JavaScript from Apple Events" is off
+    console.log(e.message)
+    $.exit(1)
+  }
+
+  // Script didn't run, so the wrapper didn't return a string
+  if (typeof(out) !== 'string') {
+    return JSON.stringify({error: {name: 'SyntaxError', message: 'script did not run'}})
+  }
+  return out
+}
+
+function run(argv) {
+  var winIdx = 0,
+      tabIdx = 0;
+
+  if (argv.length != 3) {
+    console.log('Usage: SafariEvalJS.js <win> <tab> <expression>')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  winIdx = parseInt(argv[0], 10)
+  tabIdx = parseInt(argv[1], 10)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[0])
+    $.exit(1)
+  }
+  if (isNaN(tabIdx)) {
+    console.log('Invalid tab: ' + argv[1])
+    $.exit(1)
+  }
+
+  return evalJSInTab(winIdx, tabIdx, argv[2])
+}
+`
+
+	// jsOpen <url> <win> [new-window|private|background...] -> JSON | Open
+	// URL in a new tab or window
+	jsOpen = `
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
+// tabInfo | Return data for tab tabIdx of window win, which is at winIdx
+function tabInfo(win, winIdx, tab, tabIdx) {
+  return {id: tabID(tab), title: tab.name(), url: tab.url(), index: tabIdx,
+    windowIndex: winIdx, windowID: win.id(), active: win.currentTab.index() === tabIdx}
+}
+
+// openTab | Open url in a new tab in window winIdx
+function openTab(url, winIdx, background) {
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  win.tabs.push(safari.Tab({url: url}))
+  var tabIdx = win.tabs.length,
+    tab = win.tabs[tabIdx-1]()
+
+  if (!background) {
+    win.currentTab = tab
+    if (winIdx != 1) {
+      win.visible = false
+      win.visible = true
+    }
+    safari.activate()
+    winIdx = 1
+  }
+  return tabInfo(win, winIdx, tab, tabIdx)
+}
+
+// openWindow | Open url in a new window
+function openWindow(url, background) {
+  safari.Document().make()
+  var win = safari.windows[0]()
+  win.currentTab.url = url
+  if (!background) {
+    safari.activate()
+  }
+  return tabInfo(win, 1, win.currentTab(), 1)
+}
+
+// openPrivate | Open url in a new private window. Safari can't script
+// private windows, so this presses ⌘⇧N via System Events.
+function openPrivate(url) {
+  var n = safari.windows.length
+  safari.activate()
+  Application('System Events').keystroke('n', {using: ['command down', 'shift down']})
+
+  for (var i = 0; i < 50 && safari.windows.length === n; i++) {
+    delay(0.1)
+  }
+  if (safari.windows.length === n) {
+    console.log('Private window did not open')
+    $.exit(1)
+  }
+
+  var win = safari.windows[0]()
+  win.currentTab.url = url
+  return tabInfo(win, 1, win.currentTab(), 1)
+}
+
+function run(argv) {
+  if (argv.length < 2) {
+    console.log('Usage: SafariOpen.js <url> <win> [new-window|private|background...]')
+    $.exit(1)
+  }
+
+  var url = argv[0],
+    winIdx = parseInt(argv[1], 10),
+    flags = argv.slice(2)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[1])
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    safari.launch()
+  }
+
+  if (flags.indexOf('private') > -1) {
+    return JSON.stringify(openPrivate(url))
+  }
+  if (flags.indexOf('new-window') > -1 || safari.windows.length === 0) {
+    return JSON.stringify(openWindow(url, flags.indexOf('background') > -1))
+  }
+  return JSON.stringify(openTab(url, winIdx, flags.indexOf('background') > -1))
+}
+`
+
+	// jsNavigate <action> <win> <tab> [<url>] | Load a URL in a tab, or
+	// reload, go back, go forward or stop loading
+	jsNavigate = `
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+// Actions that need "Allow JavaScript from Apple Events"
+var scripts = {
+  // Setting a tab's URL to itself doesn't reload the page if the URL has
+  // a #fragment, and fails if the tab has no URL
+  'reload': 'location.reload()',
+  'back': 'history.back()',
+  'forward': 'history.forward()',
+  'stop': 'window.stop()',
+}
+
+
+// navigate <action> <win> <tab> <url> | Perform action in tab
+function navigate(action, winIdx, tabIdx, url) {
+
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  try {
+    var tab = win.tabs[tabIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+
+  if (action === 'go') {
+    tab.url = url
+    return
+  }
+
+  try {
+    safari.doJavaScript(scripts[action], {in: tab})
+  }
+  catch (e) {
+    console.log(e.message)
+    $.exit(1)
+  }
+}
+
+function run(argv) {
+  var action = argv[0],
+    winIdx = 0,
+    tabIdx = 0;
+
+  if (argv.length < 3 || (action === 'go' && argv.length != 4)) {
+    console.log('Usage: SafariNavigate.js (go|reload|back|forward|stop) <win> <tab> [<url>]')
+    $.exit(1)
+  }
+
+  if (action !== 'go' && !scripts.hasOwnProperty(action)) {
+    console.log('Invalid action: ' + action)
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  winIdx = parseInt(argv[1], 10)
+  tabIdx = parseInt(argv[2], 10)
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[1])
+    $.exit(1)
+  }
+  if (isNaN(tabIdx)) {
+    console.log('Invalid tab: ' + argv[2])
+    $.exit(1)
+  }
+
+  navigate(action, winIdx, tabIdx, argv[3])
+}
+`
+
+	// jsMove <win> <tab> <to-win> <to-tab> -> JSON | Move a tab to position
+	// <to-tab> in window <to-win>. <to-win> 0 means a new window, and
+	// <to-tab> 0 means the end of the window.
+	jsMove = `
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// tabID | Safari's ID for tab, or '' if it doesn't have one
+function tabID(tab) {
+  try {
+    return String(tab.id())
+  }
+  catch (e) {
+    return ''
+  }
+}
+
+// getWindow | Return window winIdx
+function getWindow(winIdx) {
+  try {
+    return safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+}
+
+// windowIndex | Return the current index of window win
+function windowIndex(win) {
+  var id = win.id(),
+    ids = safari.windows.id()
+
+  for (var i = 0; i < ids.length; i++) {
+    if (ids[i] === id) {
+      return i+1
+    }
+  }
+  return 0
+}
+
+// moveTab | Move tab tabIdx of window winIdx and return the tab's data
+function moveTab(winIdx, tabIdx, toWinIdx, toTabIdx) {
+  var win = getWindow(winIdx)
+
+  if (tabIdx < 1 || tabIdx > win.tabs.length) {
+    console.log('Invalid tab for window ' + winIdx + ': ' + tabIdx)
+    $.exit(1)
+  }
+  var tab = win.tabs[tabIdx-1],
+    newWin = toWinIdx === 0
+
+  if (newWin) {
+    safari.Document().make()
+    var toWin = safari.windows[0](),
+      blank = toWin.tabs[0]()
+    safari.move(tab, {to: toWin.tabs.end})
+    blank.close()
+    toWinIdx = 1
+    toTabIdx = 1
+  } else {
+    var toWin = getWindow(toWinIdx),
+      n = toWin.tabs.length,
+      same = toWinIdx === winIdx
+
+    if (toTabIdx < 1 || toTabIdx > n || (same && toTabIdx === n)) {
+      safari.move(tab, {to: toWin.tabs.end})
+      toTabIdx = toWin.tabs.length
+    } else if (same && toTabIdx > tabIdx) {
+      safari.move(tab, {to: toWin.tabs[toTabIdx-1].after})
+    } else if (!same || toTabIdx < tabIdx) {
+      safari.move(tab, {to: toWin.tabs[toTabIdx-1].before})
+    }
+  }
+
+  // Safari closes a window when its last tab is moved out, which changes
+  // the indices of the windows behind it
+  toWinIdx = windowIndex(toWin)
+
+  var moved = toWin.tabs[toTabIdx-1]
+  return {id: tabID(moved), title: moved.name(), url: moved.url(), index: toTabIdx,
+    windowIndex: toWinIdx, windowID: toWin.id(), active: toWin.currentTab.index() === toTabIdx}
+}
+
+function run(argv) {
+  if (argv.length != 4) {
+    console.log('Usage: SafariMove.js <win> <tab> <to-win> <to-tab>')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  var args = argv.map(function(s) { return parseInt(s, 10) })
+  if (isNaN(args[0]) || isNaN(args[2])) {
+    console.log('Invalid window: ' + argv[0] + ', ' + argv[2])
+    $.exit(1)
+  }
+  if (isNaN(args[1]) || isNaN(args[3])) {
+    console.log('Invalid tab: ' + argv[1] + ', ' + argv[3])
+    $.exit(1)
+  }
+
+  return JSON.stringify(moveTab(args[0], args[1], args[2], args[3]))
+}
+`
+
+	// jsReorder <win> <tab>... | Reorder the tabs of a window. The new order
+	// is given as the tabs' current indices.
+	jsReorder = `
+
+ObjC.import('stdlib')
+
+var safari = Application('Safari')
+safari.includeStandardAdditions = true
+
+
+// reorder | Put the tabs of window winIdx in order
+function reorder(winIdx, order) {
+  try {
+    var win = safari.windows[winIdx-1]()
+  }
+  catch (e) {
+    console.log('Invalid window: ' + winIdx)
+    $.exit(1)
+  }
+
+  var n = win.tabs.length,
+    current = []
+
+  if (order.length != n) {
+    console.log('Invalid tab order for window ' + winIdx + ': ' + order.length + ' tabs, expected ' + n)
+    $.exit(1)
+  }
+
+  // current holds the original indices of the tabs in their current order
+  for (var i = 1; i <= n; i++) {
+    current.push(i)
+  }
+
+  for (var i = 1; i <= n; i++) {
+    var pos = current.indexOf(order[i-1]) + 1
+    if (pos === 0) {
+      console.log('Invalid tab for window ' + winIdx + ': ' + order[i-1])
+      $.exit(1)
+    }
+    if (pos === i) continue
+
+    // pos > i, as tabs before i are in their final positions
+    safari.move(win.tabs[pos-1], {to: win.tabs[i-1].before})
+    current.splice(i-1, 0, current.splice(pos-1, 1)[0])
+  }
+}
+
+function run(argv) {
+  if (argv.length < 1) {
+    console.log('Usage: SafariReorder.js <win> <tab>...')
+    $.exit(1)
+  }
+
+  if (!safari.running()) {
+    console.log('Safari is not running')
+    $.exit(1)
+  }
+
+  var winIdx = parseInt(argv[0], 10),
+    order = argv.slice(1).map(function(s) { return parseInt(s, 10) })
+
+  if (isNaN(winIdx)) {
+    console.log('Invalid window: ' + argv[0])
+    $.exit(1)
+  }
+
+  reorder(winIdx, order)
+}
+`
+
+	// jsWorker | Read newline-delimited JSON requests from STDIN, run the
+	// requested script and write the response to STDOUT. workerScript()
+	// appends the scripts to load.
+	jsWorker = `
+
+ObjC.import('Foundation')
+
+var stdin = $.NSFileHandle.fileHandleWithStandardInput,
+  stdout = $.NSFileHandle.fileHandleWithStandardOutput,
+  buffer = '',
+  scripts = {}
+
+// Exit | Thrown by a script's $.exit()
+function Exit(code, message) {
+  this.code = code
+  this.message = message
+}
+
+// load | Compile script source once. Returns a function that takes
+// replacements for $ and console, and returns the script's run function.
+function load(src) {
+  return new Function('$', 'console', src + '\nreturn run')
+}
+
+// call | Run script name with argv. console.log output is returned as
+// the error message if the script calls $.exit with a non-zero status.
+function call(name, argv) {
+  var logs = [],
+    con = {log: function() { logs.push(Array.prototype.slice.call(arguments).join(' ')) }},
+    shim = {exit: function(code) { throw new Exit(code, logs.join('\n')) }}
+
+  if (!scripts.hasOwnProperty(name)) {
+    throw new Error('Unknown script: ' + name)
+  }
+
+  try {
+    var out = scripts[name](shim, con)(argv)
+  }
+  catch (e) {
+    if (e instanceof Exit) {
+      if (e.code === 0) return ''
+      throw new Error(e.message || 'exit status ' + e.code)
+    }
+    throw e
+  }
+  return out === undefined ? '' : String(out)
+}
+
+// readLine | Read a line from STDIN. Returns null at EOF. Requests are
+// pure ASCII, so chunks can be decoded individually.
+function readLine() {
+  while (buffer.indexOf('\n') === -1) {
+    var data = stdin.availableData
+    if (data.length === 0) return null
+    buffer += $.NSString.alloc.initWithDataEncoding(data, $.NSUTF8StringEncoding).js
+  }
+  var i = buffer.indexOf('\n'),
+    line = buffer.slice(0, i)
+  buffer = buffer.slice(i+1)
+  return line
+}
+
+// writeLine | Write obj to STDOUT as a line of JSON
+function writeLine(obj) {
+  var s = $.NSString.alloc.initWithUTF8String(JSON.stringify(obj) + '\n')
+  stdout.writeData(s.dataUsingEncoding($.NSUTF8StringEncoding))
+}
+
+function run(argv) {
+  var line
+  while ((line = readLine()) !== null) {
+    if (line === '') continue
+    var req = JSON.parse(line),
+      resp = {id: req.id}
+    try {
+      resp.output = call(req.script, req.args || [])
+    }
+    catch (e) {
+      resp.error = String(e.message || e)
+      if (e.errorNumber) resp.error += ' (' + e.errorNumber + ')'
+    }
+    writeLine(resp)
+  }
+}
 `
 )
+
+// jxaScripts are the scripts a Worker loads, keyed by the name requests
+// refer to them by.
+var jxaScripts = map[string]string{
+	"tabs":        jsGetTabs,
+	"current-tab": jsGetCurrentTab,
+	"activate":    jsActivate,
+	"close":       jsClose,
+	"run-js":      jsRunJavaScript,
+	"eval-js":     jsEvalJavaScript,
+	"open":        jsOpen,
+	"navigate":    jsNavigate,
+	"move":        jsMove,
+	"reorder":     jsReorder,
+}
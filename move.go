@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-07
+//
+
+package safari
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SortKey specifies how SortTabs orders tabs.
+type SortKey string
+
+// Valid SortKeys. Sorting is case-insensitive.
+const (
+	SortTitle SortKey = "title" // By title
+	SortURL   SortKey = "url"   // By URL
+	SortHost  SortKey = "host"  // By hostname, ignoring "www.", then by URL
+)
+
+// MoveTab moves the specified tab to position toTab in window toWin. If win
+// or toWin is 0, the frontmost window is assumed. If toTab is 0, the tab is
+// moved to the end of the window. Use MoveTabToNewWindow to move a tab to a
+// new window.
+func MoveTab(win, tab, toWin, toTab int) error {
+	return MoveTabContext(context.Background(), win, tab, toWin, toTab)
+}
+
+// MoveTabContext is like MoveTab, but aborts if ctx is cancelled.
+func MoveTabContext(ctx context.Context, win, tab, toWin, toTab int) error {
+	if win == 0 {
+		win = 1
+	}
+	if toWin == 0 {
+		toWin = 1
+	}
+	_, err := backend.Move(ctx, win, tab, toWin, toTab)
+	return err
+}
+
+// MoveTabToNewWindow moves the specified tab to a new window. If win is 0,
+// the frontmost window is assumed.
+func MoveTabToNewWindow(win, tab int) error {
+	return MoveTabToNewWindowContext(context.Background(), win, tab)
+}
+
+// MoveTabToNewWindowContext is like MoveTabToNewWindow, but aborts if ctx
+// is cancelled.
+func MoveTabToNewWindowContext(ctx context.Context, win, tab int) error {
+	if win == 0 {
+		win = 1
+	}
+	_, err := backend.Move(ctx, win, tab, 0, 0)
+	return err
+}
+
+// MoveTo moves this tab to position index in window win. As with MoveTab,
+// if win is 0, the frontmost window is assumed, and if index is 0, the tab
+// is moved to the end of the window. Use MoveToNewWindow to move the tab to
+// a new window. The tab's fields are updated to reflect its new position.
+func (t *Tab) MoveTo(win, index int) error {
+	return t.MoveToContext(context.Background(), win, index)
+}
+
+// MoveToContext is like MoveTo, but aborts if ctx is cancelled.
+func (t *Tab) MoveToContext(ctx context.Context, win, index int) error {
+	if win == 0 {
+		win = 1
+	}
+	return t.move(ctx, win, index)
+}
+
+// MoveToNewWindow moves this tab to a new window.
+func (t *Tab) MoveToNewWindow() error {
+	return t.MoveToNewWindowContext(context.Background())
+}
+
+// MoveToNewWindowContext is like MoveToNewWindow, but aborts if ctx is
+// cancelled.
+func (t *Tab) MoveToNewWindowContext(ctx context.Context) error {
+	return t.move(ctx, 0, 0)
+}
+
+// move moves this tab and updates its fields.
+func (t *Tab) move(ctx context.Context, win, index int) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	moved, err := backend.Move(ctx, t.WindowIndex, t.Index, win, index)
+	if err != nil {
+		return err
+	}
+
+	setIDs(moved)
+	t.WindowIndex, t.Index, t.Active, t.WindowID = moved.WindowIndex, moved.Index, moved.Active, moved.WindowID
+	// A derived ID contains the window's ID, so it changes
+	if t.ID != "" {
+		t.ID = moved.ID
+	}
+	return nil
+}
+
+// SortTabs sorts the tabs in window win by key. If win is 0, the frontmost
+// window is sorted. The sort is stable, so tabs with the same key stay in
+// the same order.
+func SortTabs(win int, key SortKey) error {
+	return SortTabsContext(context.Background(), win, key)
+}
+
+// SortTabsContext is like SortTabs, but aborts if ctx is cancelled.
+func SortTabsContext(ctx context.Context, win int, key SortKey) error {
+	if win == 0 {
+		win = 1
+	}
+
+	var keyFunc func(t *Tab) string
+	switch key {
+	case SortTitle:
+		keyFunc = func(t *Tab) string { return strings.ToLower(t.Title) }
+	case SortURL:
+		keyFunc = func(t *Tab) string { return strings.ToLower(t.URL) }
+	case SortHost:
+		keyFunc = func(t *Tab) string {
+			var host string
+			if u, err := url.Parse(t.URL); err == nil {
+				host = strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+			}
+			return host + " " + strings.ToLower(t.URL)
+		}
+	default:
+		return fmt.Errorf("invalid sort key: %s", key)
+	}
+
+	// Reorder uses indices, so they must be Safari's current ones
+	wins, err := windows(ctx, uncached(backend))
+	if err != nil {
+		return err
+	}
+	var tabs []*Tab
+	for _, w := range wins {
+		if w.Index == win {
+			tabs = append(tabs, w.Tabs...)
+			break
+		}
+	}
+	if tabs == nil {
+		return fmt.Errorf("%w: %d", ErrNoSuchWindow, win)
+	}
+
+	sort.SliceStable(tabs, func(i, j int) bool { return keyFunc(tabs[i]) < keyFunc(tabs[j]) })
+
+	var (
+		order  []int
+		sorted = true
+	)
+	for i, t := range tabs {
+		order = append(order, t.Index)
+		if t.Index != i+1 {
+			sorted = false
+		}
+	}
+	if sorted {
+		return nil
+	}
+	return backend.Reorder(ctx, win, order)
+}
@@ -0,0 +1,142 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-07
+//
+
+package safari
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoveTab(t *testing.T) {
+	tests := []struct {
+		name                   string
+		win, tab, toWin, toTab int
+		x                      string
+		setup                  func(fb *FakeBackend)
+	}{
+		{"left", 1, 4, 1, 1, "d a *b c e|*x y", nil},
+		{"right", 1, 1, 1, 3, "*b c a d e|*x y", nil},
+		{"same place", 1, 2, 1, 2, "a *b c d e|*x y", nil},
+		{"end", 1, 1, 1, 0, "*b c d e a|*x y", nil},
+		{"current", 1, 2, 1, 5, "a c d e *b|*x y", nil},
+		{"other window", 1, 3, 2, 2, "a *b d e|*x c y", nil},
+		{"other window end", 2, 2, 1, 0, "a *b c d e y|*x", nil},
+		{"current to other window", 1, 2, 2, 1, "a *c d e|b *x y", nil},
+		{"last tab", 2, 1, 2, 0, "a *b c d e|y *x", nil},
+		{"front window", 2, 2, 0, 1, "y a *b c d e|*x", nil},
+		{"other window start", 2, 2, 1, 1, "y a *b c d e|*x", nil},
+		{"empty window", 2, 1, 1, 1, "x a *b c d e",
+			func(fb *FakeBackend) { fb.Wins[1].Tabs = fb.Wins[1].Tabs[:1] }},
+		{"empty front window", 1, 1, 2, 0, "*x y a",
+			func(fb *FakeBackend) { fb.Wins[0].Tabs = fb.Wins[0].Tabs[:1] }},
+	}
+
+	for _, td := range tests {
+		fb, restore := newTestBackend()
+		if td.setup != nil {
+			td.setup(fb)
+		}
+		if err := MoveTab(td.win, td.tab, td.toWin, td.toTab); err != nil {
+			t.Errorf("%s: %v", td.name, err)
+		} else if s := layout(t); s != td.x {
+			t.Errorf("%s: Expected=%q, Got=%q", td.name, td.x, s)
+		}
+		restore()
+	}
+}
+
+func TestMoveTabToNewWindow(t *testing.T) {
+	_, restore := newTestBackend()
+	defer restore()
+
+	if err := MoveTabToNewWindow(1, 5); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "*e|a *b c d|*x y" {
+		t.Errorf("Expected=%q, Got=%q", "*e|a *b c d|*x y", s)
+	}
+}
+
+func TestTabMoveTo(t *testing.T) {
+	_, restore := newTestBackend()
+	defer restore()
+
+	c := findTab(t, "c")
+	if err := ActivateWin(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MoveTo(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "c *x y|a *b d e" {
+		t.Errorf("move: Expected=%q, Got=%q", "c *x y|a *b d e", s)
+	}
+	if c.WindowIndex != 1 || c.Index != 1 {
+		t.Errorf("bad position. Expected=1x1, Got=%dx%d", c.WindowIndex, c.Index)
+	}
+
+	// Tab can still be found
+	if err := c.MoveToNewWindow(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MoveTo(3, 2); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "*x y|a c *b d e" {
+		t.Errorf("move back: Expected=%q, Got=%q", "*x y|a c *b d e", s)
+	}
+	// c's new window closed, so its destination is now window 2
+	if c.WindowIndex != 2 || c.Index != 2 {
+		t.Errorf("bad position. Expected=2x2, Got=%dx%d", c.WindowIndex, c.Index)
+	}
+
+	if err := MoveTab(1, 9, 1, 1); !errors.Is(err, ErrNoSuchTab) {
+		t.Errorf("bad tab: Expected=ErrNoSuchTab, Got=%v", err)
+	}
+	if err := MoveTab(1, 1, 5, 1); !errors.Is(err, ErrNoSuchWindow) {
+		t.Errorf("bad window: Expected=ErrNoSuchWindow, Got=%v", err)
+	}
+}
+
+func TestSortTabs(t *testing.T) {
+	fb := NewFakeBackend(&FakeWindow{Current: 2, Tabs: []*FakeTab{
+		{Title: "Zebra", URL: "https://www.b.example.com/2"},
+		{Title: "apple", URL: "https://c.example.com/"},
+		{Title: "Mango", URL: "https://a.example.com/"},
+		{Title: "banana", URL: "https://b.example.com/1"},
+	}})
+	prev := backend
+	SetBackend(fb)
+	defer SetBackend(prev)
+
+	tests := []struct {
+		key SortKey
+		x   string
+	}{
+		{SortTitle, "*apple banana Mango Zebra"},
+		{SortURL, "Mango banana *apple Zebra"},
+		{SortHost, "Mango banana Zebra *apple"},
+	}
+	for _, td := range tests {
+		if err := SortTabs(0, td.key); err != nil {
+			t.Errorf("%s: %v", td.key, err)
+			continue
+		}
+		if s := layout(t); s != td.x {
+			t.Errorf("%s: Expected=%q, Got=%q", td.key, td.x, s)
+		}
+	}
+
+	if err := SortTabs(2, SortTitle); !errors.Is(err, ErrNoSuchWindow) {
+		t.Errorf("bad window: Expected=ErrNoSuchWindow, Got=%v", err)
+	}
+	if err := SortTabs(1, "colour"); err == nil {
+		t.Error("invalid key accepted")
+	}
+}
@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-05
+//
+
+package safari
+
+import "context"
+
+// OpenOptions specify where OpenURL opens a URL. The zero value opens the
+// URL in a new tab in the frontmost window, and makes it the current tab.
+type OpenOptions struct {
+	Window     int  // Window to open a new tab in. 0 means the frontmost window.
+	NewWindow  bool // Open URL in a new window
+	Private    bool // Open URL in a new private window
+	Background bool // Don't make the new tab current or activate Safari
+}
+
+// OpenOption sets an OpenOptions field.
+type OpenOption func(*OpenOptions)
+
+// InWindow opens the URL in a new tab in window win.
+func InWindow(win int) OpenOption {
+	return func(o *OpenOptions) { o.Window = win }
+}
+
+// InNewWindow opens the URL in a new window.
+func InNewWindow(v bool) OpenOption {
+	return func(o *OpenOptions) { o.NewWindow = v }
+}
+
+// InPrivateWindow opens the URL in a new private window.
+//
+// Safari can't open private windows via AppleScript, so OSAScript presses
+// ⌘⇧N instead. This activates Safari, and requires the program to have
+// Accessibility access.
+func InPrivateWindow(v bool) OpenOption {
+	return func(o *OpenOptions) { o.Private = v }
+}
+
+// InBackground opens the URL without making its tab current or
+// activating Safari.
+func InBackground(v bool) OpenOption {
+	return func(o *OpenOptions) { o.Background = v }
+}
+
+// OpenURL opens URL in Safari and returns the new tab. By default, the URL
+// is opened in a new tab in the frontmost window, which is made the
+// current tab. If Safari has no windows, a new window is opened.
+//
+// The page won't have loaded yet, so the tab's Title is probably empty.
+// Unless Safari provides IDs, the tab's ID is empty too, as an ID derived
+// from the URL and title would change when the page loads. The tab's
+// methods then use WindowIndex and Index as they are. Get the tab from
+// Windows after the page has loaded to identify it reliably.
+func OpenURL(URL string, opts ...OpenOption) (*Tab, error) {
+	return OpenURLContext(context.Background(), URL, opts...)
+}
+
+// OpenURLContext is like OpenURL, but aborts if ctx is cancelled.
+func OpenURLContext(ctx context.Context, URL string, opts ...OpenOption) (*Tab, error) {
+	o := OpenOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Window == 0 {
+		o.Window = 1
+	}
+
+	return backend.Open(ctx, URL, o)
+}
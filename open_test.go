@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-05
+//
+
+package safari
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOpenURL(t *testing.T) {
+	const URL = "https://new.example.com/"
+
+	tests := []struct {
+		name        string
+		opts        []OpenOption
+		win, tab    int  // expected position of new tab
+		active      bool // whether new tab is current tab
+		nwin        int  // expected no. of windows
+		private     bool
+		frontTitles string // titles of tabs in front window
+	}{
+		{"default", nil, 1, 6, true, 2, false, "a b c d e "},
+		{"window", []OpenOption{InWindow(2)}, 1, 3, true, 2, false, "x y "},
+		{"background", []OpenOption{InBackground(true)}, 1, 6, false, 2, false, "a b c d e "},
+		{"background window", []OpenOption{InWindow(2), InBackground(true)}, 2, 3, false, 2, false, "a b c d e"},
+		{"new window", []OpenOption{InNewWindow(true)}, 1, 1, true, 3, false, ""},
+		{"private", []OpenOption{InPrivateWindow(true)}, 1, 1, true, 3, true, ""},
+	}
+
+	for _, td := range tests {
+		fb, restore := newTestBackend()
+
+		tab, err := OpenURL(URL, td.opts...)
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			restore()
+			continue
+		}
+		if tab.WindowIndex != td.win || tab.Index != td.tab || tab.Active != td.active {
+			t.Errorf("%s: bad tab. Expected=%dx%d (active=%v), Got=%dx%d (active=%v)",
+				td.name, td.win, td.tab, td.active, tab.WindowIndex, tab.Index, tab.Active)
+		}
+		if tab.URL != URL || tab.ID != "" {
+			t.Errorf("%s: bad URL or ID: %q, %q", td.name, tab.URL, tab.ID)
+		}
+
+		wins, err := Windows()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wins) != td.nwin {
+			t.Errorf("%s: bad no. of windows. Expected=%d, Got=%d", td.name, td.nwin, len(wins))
+		}
+		if got := wins[tab.WindowIndex-1].Tabs[tab.Index-1]; got.URL != URL {
+			t.Errorf("%s: new tab not at %dx%d", td.name, tab.WindowIndex, tab.Index)
+		}
+		if fb.Wins[tab.WindowIndex-1].Private != td.private {
+			t.Errorf("%s: bad Private. Expected=%v, Got=%v", td.name, td.private, !td.private)
+		}
+		var titles []string
+		for _, tab := range wins[0].Tabs {
+			titles = append(titles, tab.Title)
+		}
+		if s := strings.Join(titles, " "); s != td.frontTitles {
+			t.Errorf("%s: bad front window. Expected=%q, Got=%q", td.name, td.frontTitles, s)
+		}
+		restore()
+	}
+}
+
+func TestOpenURLErrors(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+
+	if _, err := OpenURL("https://new.example.com/", InWindow(3)); !errors.Is(err, ErrNoSuchWindow) {
+		t.Errorf("bad window: Expected=ErrNoSuchWindow, Got=%v", err)
+	}
+
+	// No windows
+	fb.Wins = nil
+	tab, err := OpenURL("https://new.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.WindowIndex != 1 || tab.Index != 1 || len(fb.Wins) != 1 {
+		t.Errorf("bad tab. Expected=1x1 in 1 window, Got=%dx%d in %d windows", tab.WindowIndex, tab.Index, len(fb.Wins))
+	}
+
+	// Tab can still be used after the page has loaded
+	fb.Wins[0].Tabs[0].Title = "Loaded"
+	if err := tab.Reload(); err != nil {
+		t.Errorf("reload after load: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-18
+//
+
+package safari
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reading List keys in Bookmarks.plist.
+const (
+	keyDateLastViewed = "DateLastViewed"
+)
+
+// ReadingListUnread returns Reading List items that haven't been viewed.
+func (p *Parser) ReadingListUnread() []*Bookmark {
+	return p.filterReadingList(func(bm *Bookmark) bool {
+		return bm.ReadingList == nil || bm.ReadingList.Unread()
+	})
+}
+
+// ReadingListOlderThan returns Reading List items that were added more
+// than age ago.
+func (p *Parser) ReadingListOlderThan(age time.Duration) []*Bookmark {
+	cutoff := time.Now().Add(-age)
+	return p.filterReadingList(func(bm *Bookmark) bool {
+		return bm.ReadingList != nil && bm.ReadingList.DateAdded.Before(cutoff)
+	})
+}
+
+// ReadingListByDateAdded returns Reading List items sorted by the date they
+// were added, oldest first.
+func (p *Parser) ReadingListByDateAdded() []*Bookmark {
+	r := p.filterReadingList(func(bm *Bookmark) bool { return true })
+	sort.Stable(ByDateAdded(r))
+	return r
+}
+
+// MarkRead marks Reading List item bm as read by setting its
+// DateLastViewed to the current time.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) MarkRead(bm *Bookmark) error {
+	rl, err := p.readingListEntry(bm)
+	if err != nil {
+		return err
+	}
+	rl[keyDateLastViewed] = time.Now().UTC()
+	return p.reload()
+}
+
+// MarkUnread marks Reading List item bm as unread by removing its
+// DateLastViewed.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) MarkUnread(bm *Bookmark) error {
+	rl, err := p.readingListEntry(bm)
+	if err != nil {
+		return err
+	}
+	delete(rl, keyDateLastViewed)
+	return p.reload()
+}
+
+// RemoveFromReadingList deletes Reading List item bm. Unlike DeleteItem,
+// it returns an error if bm is not in the Reading List.
+//
+// Changes are not written to disk until Save is called.
+func (p *Parser) RemoveFromReadingList(bm *Bookmark) error {
+	if _, err := p.readingListEntry(bm); err != nil {
+		return err
+	}
+	return p.DeleteItem(bm)
+}
+
+// readingListEntry returns the untyped Reading List metadata for bm,
+// creating it if necessary.
+func (p *Parser) readingListEntry(bm *Bookmark) (map[string]interface{}, error) {
+	d, _, err := p.findItem(bm)
+	if err != nil {
+		return nil, err
+	}
+	if cur := p.BookmarkForUID(bm.UID()); cur == nil || !cur.InReadingList() {
+		return nil, fmt.Errorf("%w: not in Reading List: %s", ErrNotFound, bm.UID())
+	}
+
+	rl, ok := d[keyReadingLst].(map[string]interface{})
+	if !ok {
+		rl = map[string]interface{}{}
+		d[keyReadingLst] = rl
+	}
+	return rl, nil
+}
+
+// filterReadingList returns Reading List items for which accept(bm) returns true.
+func (p *Parser) filterReadingList(accept func(bm *Bookmark) bool) []*Bookmark {
+	r := []*Bookmark{}
+	for _, bm := range p.BookmarksRL {
+		if accept(bm) {
+			r = append(r, bm)
+		}
+	}
+	return r
+}
+
+// ByDateAdded sorts Reading List Bookmarks by date added (oldest first).
+// Bookmarks without Reading List metadata sort first.
+type ByDateAdded []*Bookmark
+
+// Implement sort.Interface
+func (s ByDateAdded) Len() int      { return len(s) }
+func (s ByDateAdded) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s ByDateAdded) Less(i, j int) bool {
+	if s[j].ReadingList == nil {
+		return false
+	}
+	if s[i].ReadingList == nil {
+		return true
+	}
+	return s[i].ReadingList.DateAdded.Before(s[j].ReadingList.DateAdded)
+}
+
+// ReadingListUnread returns the default Parser's Reading List items that
+// haven't been viewed.
+func ReadingListUnread() ([]*Bookmark, error) {
+	p, err := defaultParser()
+	if err != nil {
+		return nil, err
+	}
+	return p.ReadingListUnread(), nil
+}
+
+// ReadingListOlderThan returns the default Parser's Reading List items
+// added more than age ago.
+func ReadingListOlderThan(age time.Duration) ([]*Bookmark, error) {
+	p, err := defaultParser()
+	if err != nil {
+		return nil, err
+	}
+	return p.ReadingListOlderThan(age), nil
+}
+
+// ReadingListByDateAdded returns the default Parser's Reading List items
+// sorted by date added.
+func ReadingListByDateAdded() ([]*Bookmark, error) {
+	p, err := defaultParser()
+	if err != nil {
+		return nil, err
+	}
+	return p.ReadingListByDateAdded(), nil
+}
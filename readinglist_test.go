@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-02-18
+//
+
+package safari
+
+import (
+	"testing"
+	"time"
+
+	"howett.net/plist"
+)
+
+// uids returns the UIDs of Bookmarks.
+func uids(bookmarks []*Bookmark) []string {
+	r := []string{}
+	for _, bm := range bookmarks {
+		r = append(r, bm.UID())
+	}
+	return r
+}
+
+// TestReadingListInfo tests that Reading List metadata are parsed.
+func TestReadingListInfo(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm := p.BookmarkForUID("RL1")
+	if bm.ReadingList == nil {
+		t.Fatal("no Reading List info")
+	}
+	if bm.ReadingList.DateAdded.IsZero() || bm.ReadingList.DateLastViewed.IsZero() {
+		t.Errorf("dates not parsed: %#v", bm.ReadingList)
+	}
+	if bm.ReadingList.PreviewText != "An old post" || bm.Preview != "An old post" {
+		t.Errorf("bad preview: %q", bm.ReadingList.PreviewText)
+	}
+	if p.BookmarkForUID("BM1").ReadingList != nil {
+		t.Error("normal bookmark has Reading List info")
+	}
+
+	tests := []struct {
+		name string
+		got  []*Bookmark
+		x    []string
+	}{
+		{"unread", p.ReadingListUnread(), []string{"RL2"}},
+		{"older", p.ReadingListOlderThan(7 * 24 * time.Hour), []string{"RL1"}},
+		{"sorted", p.ReadingListByDateAdded(), []string{"RL1", "RL2"}},
+	}
+	for _, td := range tests {
+		got := uids(td.got)
+		if len(got) != len(td.x) {
+			t.Errorf("%s: Expected=%v, Got=%v", td.name, td.x, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != td.x[i] {
+				t.Errorf("%s: Expected=%v, Got=%v", td.name, td.x, got)
+				break
+			}
+		}
+	}
+}
+
+// TestReadingListEdit tests marking items read/unread and removing them.
+func TestReadingListEdit(t *testing.T) {
+	path, cleanup := writeTestBookmarks(t, plist.BinaryFormat)
+	defer cleanup()
+	p, err := New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.MarkRead(p.BookmarkForUID("RL2")); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if err := p.MarkUnread(p.BookmarkForUID("RL1")); err != nil {
+		t.Fatalf("MarkUnread: %v", err)
+	}
+	if err := p.MarkRead(p.BookmarkForUID("BM1")); err == nil {
+		t.Error("MarkRead accepted bookmark not in Reading List")
+	}
+	if err := p.RemoveFromReadingList(p.BookmarkForUID("BM1")); err == nil {
+		t.Error("RemoveFromReadingList accepted bookmark not in Reading List")
+	}
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = New(BookmarksPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(p.ReadingListUnread()); len(got) != 1 || got[0] != "RL1" {
+		t.Errorf("bad unread items. Expected=[RL1], Got=%v", got)
+	}
+	if p.BookmarkForUID("RL2").ReadingList.DateAdded.IsZero() {
+		t.Error("DateAdded lost")
+	}
+
+	if err := p.RemoveFromReadingList(p.BookmarkForUID("RL1")); err != nil {
+		t.Fatalf("RemoveFromReadingList: %v", err)
+	}
+	if got := uids(p.BookmarksRL); len(got) != 1 || got[0] != "RL2" {
+		t.Errorf("bad Reading List. Expected=[RL2], Got=%v", got)
+	}
+}
@@ -13,8 +13,30 @@ Package safari provides access to Safari's windows, tabs, bookmarks etc. on the
 Package-level functions call the corresponding methods on the default Parser, which
 reads the standard Safari bookmarks file with the default options.
 
+Bookmarks and folders can be added, edited, moved and deleted via the
+Parser's editing methods. Call Parser.Save to write the changes back
+to Bookmarks.plist.
+
+The window and tab functions talk to Safari via a Backend. The default
+Backend runs JavaScript for Automation scripts with osascript. Use
+SetBackend with a FakeBackend to test code that uses tabs without Safari.
+Each window and tab function has a ...Context variant, e.g. WindowsContext,
+which kills osascript if the Context is cancelled. Programs that call
+Safari repeatedly should use a Worker, which keeps a single osascript
+process running instead of starting a new one for each call, and
+may wrap their Backend in a CachedBackend to cache windows and tabs
+for a few seconds.
+
 The history subpackage provides access to Safari's history.
 
+The importer subpackage reads bookmarks exported from other browsers.
+
+The index subpackage provides a fast full-text index of bookmarks, Reading
+List and history.
+
+The search subpackage searches tabs, bookmarks, Reading List, history and
+iCloud Tabs concurrently with a single query.
+
 The safari command is a simple command-line program that implements some of the
 library's features.
 
@@ -23,7 +45,6 @@ Tested on Sierra and High Sierra.
 package safari
 
 import (
-	"errors"
 	"io/ioutil"
 	"log"
 	"net/url"
@@ -33,6 +54,8 @@ import (
 	"time"
 
 	"howett.net/plist"
+
+	"github.com/deanishe/go-safari/internal/errs"
 )
 
 // Types of entries in Bookmarks.plist.
@@ -109,6 +132,16 @@ type Folder struct {
 	isBookmarksMenu bool
 }
 
+// NewFolder creates a Folder that doesn't belong to a Parser, e.g. to pass
+// to Parser.MergeFolder. If parent is not nil, the new Folder is added to it.
+func NewFolder(title string, parent *Folder) *Folder {
+	f := &Folder{title: title, Ancestors: childAncestors(parent)}
+	if parent != nil {
+		parent.Folders = append(parent.Folders, f)
+	}
+	return f
+}
+
 // Title returns Folder title and implements Item.
 func (f *Folder) Title() string { return f.title }
 
@@ -124,13 +157,45 @@ func (f *Folder) IsBookmarksBar() bool { return f.isBookmarksBar }
 // IsBookmarksMenu returns true if this Folder is the users's BookmarksMenu.
 func (f *Folder) IsBookmarksMenu() bool { return f.isBookmarksMenu }
 
+// ReadingListInfo is the metadata of a Reading List item.
+type ReadingListInfo struct {
+	DateAdded       time.Time
+	DateLastFetched time.Time
+	DateLastViewed  time.Time // Zero if item hasn't been read
+	PreviewText     string
+}
+
+// Unread returns true if the item has never been viewed.
+func (rl *ReadingListInfo) Unread() bool { return rl.DateLastViewed.IsZero() }
+
 // Bookmark is a Safari bookmark.
 type Bookmark struct {
-	title     string
-	URL       string
-	Ancestors []*Folder // Last element is this Bookmark's parent
-	Preview   string
-	uid       string
+	title       string
+	URL         string
+	Ancestors   []*Folder // Last element is this Bookmark's parent
+	Preview     string
+	ReadingList *ReadingListInfo // Reading List metadata. nil if Bookmark isn't in Reading List
+	uid         string
+}
+
+// NewBookmark creates a Bookmark that doesn't belong to a Parser. If parent
+// is not nil, the new Bookmark is added to it.
+func NewBookmark(title, URL string, parent *Folder) *Bookmark {
+	bm := &Bookmark{title: title, URL: URL, Ancestors: childAncestors(parent)}
+	if parent != nil {
+		parent.Bookmarks = append(parent.Bookmarks, bm)
+	}
+	return bm
+}
+
+// childAncestors returns Ancestors for an item in Folder parent.
+func childAncestors(parent *Folder) []*Folder {
+	if parent == nil {
+		return []*Folder{}
+	}
+	a := make([]*Folder, len(parent.Ancestors), len(parent.Ancestors)+1)
+	copy(a, parent.Ancestors)
+	return append(a, parent)
 }
 
 // Title returns Bookmark title and implements Item.
@@ -174,7 +239,7 @@ func (bm *Bookmark) Hostname() (string, error) {
 // bookmark isn't a bookmarklet or can't be parsed.
 func (bm *Bookmark) ToJS() (string, error) {
 	if !bm.IsBookmarklet() {
-		return "", errors.New("not a bookmarklet")
+		return "", ErrNotBookmarklet
 	}
 	return url.PathUnescape(bm.URL[11:])
 }
@@ -202,14 +267,16 @@ func IgnoreBookmarklets(v bool) Option {
 // Parser unmarshals a Bookmarks.plist file.
 type Parser struct {
 	BookmarksPath      string
-	IgnoreBookmarklets bool         // Whether to ignore bookmarklets
-	Bookmarks          []*Bookmark  // Flat list of all bookmarks (excl. Reading List)
-	BookmarksRL        []*Bookmark  // Flat list of all Reading List bookmarks
-	Folders            []*Folder    // Flat list of all folders
-	BookmarksBar       *Folder      // Folder for user's Bookmarks Bar
-	BookmarksMenu      *Folder      // Folder for user's Bookmarks Menu
-	ReadingList        *Folder      // Folder for user's Reading List
-	raw                *rawBookmark // Bookmarks.plist data in "native" format
+	IgnoreBookmarklets bool                   // Whether to ignore bookmarklets
+	Bookmarks          []*Bookmark            // Flat list of all bookmarks (excl. Reading List)
+	BookmarksRL        []*Bookmark            // Flat list of all Reading List bookmarks
+	Folders            []*Folder              // Flat list of all folders
+	BookmarksBar       *Folder                // Folder for user's Bookmarks Bar
+	BookmarksMenu      *Folder                // Folder for user's Bookmarks Menu
+	ReadingList        *Folder                // Folder for user's Reading List
+	raw                *rawBookmark           // Bookmarks.plist data in "native" format
+	data               map[string]interface{} // Untyped Bookmarks.plist data for editing
+	format             int                    // Format of Bookmarks.plist (binary or XML)
 	uid2Folder         map[string]*Folder
 	uid2Bookmark       map[string]*Bookmark
 	uid2Type           map[string]string
@@ -247,7 +314,7 @@ func (p *Parser) Parse() error {
 	// TODO: Make Bookmarks.plist optional and add iCloud tabs
 	data, err := ioutil.ReadFile(p.BookmarksPath)
 	if err != nil {
-		return err
+		return errs.File(err)
 	}
 	return p.parseData(data)
 }
@@ -256,13 +323,25 @@ func (p *Parser) Parse() error {
 func (p *Parser) parseData(data []byte) error {
 
 	p.raw = &rawBookmark{}
+	p.data = map[string]interface{}{}
 	p.Bookmarks = []*Bookmark{}
 	p.BookmarksRL = []*Bookmark{}
+	p.Folders = []*Folder{}
+	p.BookmarksBar, p.BookmarksMenu, p.ReadingList = nil, nil, nil
+	p.uid2Folder = map[string]*Folder{}
+	p.uid2Bookmark = map[string]*Bookmark{}
+	p.uid2Type = map[string]string{}
 
 	if _, err := plist.Unmarshal(data, p.raw); err != nil {
 		return err
 	}
 
+	format, err := plist.Unmarshal(data, &p.data)
+	if err != nil {
+		return err
+	}
+	p.format = format
+
 	if err := p.parseRaw(p.raw, []*Folder{}); err != nil {
 		return err
 	}
@@ -342,6 +421,12 @@ func (p *Parser) parseRaw(root *rawBookmark, ancestors []*Folder) error {
 
 			if rb.ReadingList != nil {
 				bm.Preview = rb.ReadingList.PreviewText
+				bm.ReadingList = &ReadingListInfo{
+					DateAdded:       rb.ReadingList.DateAdded,
+					DateLastFetched: rb.ReadingList.DateLastFetched,
+					DateLastViewed:  rb.ReadingList.DateLastViewed,
+					PreviewText:     rb.ReadingList.PreviewText,
+				}
 			}
 
 			if len(ancestors) > 0 {
@@ -426,14 +511,25 @@ func (p *Parser) TypeForUID(uid string) string { return p.uid2Type[uid] }
 
 // getParser returns the default Parser, creating it if necessary.
 func getParser() *Parser {
+	p, err := defaultParser()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// defaultParser returns the default Parser, creating it if necessary.
+// Unlike getParser, it returns an error if the bookmarks can't be read.
+func defaultParser() (*Parser, error) {
 	if parser != nil {
-		return parser
+		return parser, nil
 	}
-	parser, err := New()
+	p, err := New()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return parser
+	parser = p
+	return parser, nil
 }
 
 // Configure sets options on the default parser.
@@ -8,70 +8,146 @@
 
 package safari
 
-import "testing"
-
-// TestNew asserts that Bookmarks.plist is found and read.
-// func TestNew(t *testing.T) {
-// 	rb, err := New()
-// 	if err != nil {
-// 		t.Fatalf("Error reading Bookmarks.plist: %v", err)
-// 	}
-// 	if len(rb.Children) == 0 {
-// 		t.Fatal("Root has 0 children")
-// 	}
-// }
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+// testParsers returns Parsers for the binary and XML Bookmarks.plist fixtures.
+func testParsers(t *testing.T, opts ...Option) (map[string]*Parser, func()) {
+	dir, cleanup := fixtures.Dir(t)
+	parsers := map[string]*Parser{}
+	for _, name := range []string{fixtures.BookmarksFile, fixtures.BookmarksXMLFile} {
+		p, err := New(append(opts, BookmarksPath(filepath.Join(dir, name)))...)
+		if err != nil {
+			cleanup()
+			t.Fatalf("Error reading %s: %v", name, err)
+		}
+		parsers[name] = p
+	}
+	return parsers, cleanup
+}
 
 // TestNewParser asserts that Bookmarks.plist is found and read.
 func TestNewParser(t *testing.T) {
-	p, err := New()
-	if err != nil {
-		t.Fatalf("Error reading Bookmarks.plist: %v", err)
-	}
-	if len(p.raw.Children) == 0 {
-		t.Fatal("Root has 0 children")
+	parsers, cleanup := testParsers(t)
+	defer cleanup()
+	for name, p := range parsers {
+		if len(p.raw.Children) != 4 {
+			t.Errorf("%s: Root has %d children, not 4", name, len(p.raw.Children))
+		}
 	}
 }
 
 // TestParserParse tests that Bookmarks and ReadingList are populated.
 func TestParserParse(t *testing.T) {
-	p, err := New()
-	if err != nil {
-		t.Fatalf("Error reading Bookmarks.plist: %v", err)
-	}
-	if len(p.Bookmarks) == 0 {
-		t.Fatal("Root has empty Bookmarks")
+	parsers, cleanup := testParsers(t)
+	defer cleanup()
+	for name, p := range parsers {
+		if len(p.Bookmarks) != 3 {
+			t.Errorf("%s: Expected 3 Bookmarks, got %d", name, len(p.Bookmarks))
+		}
+		if len(p.BookmarksRL) != 2 {
+			t.Errorf("%s: Expected 2 ReadingList items, got %d", name, len(p.BookmarksRL))
+		}
+
+		bm := p.BookmarkForUID("BM2")
+		if bm == nil {
+			t.Fatalf("%s: Bookmark BM2 not found", name)
+		}
+		if bm.Title() != "Wiki" || bm.URL != "https://wiki.example.com/" {
+			t.Errorf("%s: Bad bookmark: %q (%s)", name, bm.Title(), bm.URL)
+		}
+		if len(bm.Ancestors) != 2 || bm.Folder().Title() != "Work" || bm.Ancestors[0] != p.BookmarksBar {
+			t.Errorf("%s: Bad ancestors: %v", name, bm.Ancestors)
+		}
+		if bm.InReadingList() {
+			t.Errorf("%s: Bookmark in Reading List", name)
+		}
+		if !p.BookmarkForUID("RL1").InReadingList() {
+			t.Errorf("%s: Reading List item not in Reading List", name)
+		}
 	}
-	if len(p.BookmarksRL) == 0 {
-		t.Fatal("Root has empty ReadingList")
+}
+
+// TestIgnoreBookmarklets tests the IgnoreBookmarklets option.
+func TestIgnoreBookmarklets(t *testing.T) {
+	parsers, cleanup := testParsers(t, IgnoreBookmarklets(true))
+	defer cleanup()
+	for name, p := range parsers {
+		if len(p.Bookmarks) != 2 {
+			t.Errorf("%s: Expected 2 Bookmarks, got %d", name, len(p.Bookmarks))
+		}
+		if p.BookmarkForUID("BM3") != nil {
+			t.Errorf("%s: Bookmarklet not ignored", name)
+		}
 	}
 }
 
-// TestParserFolders tests that folders are populated.
-func TestParserFolders(t *testing.T) {
-	p, err := New()
+// TestBookmarklet tests bookmarklet helpers.
+func TestBookmarklet(t *testing.T) {
+	parsers, cleanup := testParsers(t)
+	defer cleanup()
+	p := parsers[fixtures.BookmarksFile]
+
+	bm := p.BookmarkForUID("BM3")
+	if !bm.IsBookmarklet() {
+		t.Fatal("Bookmarklet not recognised")
+	}
+	js, err := bm.ToJS()
 	if err != nil {
-		t.Fatalf("Error reading Bookmarks.plist: %v", err)
+		t.Fatal(err)
 	}
-	if len(p.Folders) == 0 {
-		t.Fatal("Root has empty Folders")
+	if js != `alert("hello")` {
+		t.Errorf("Bad JS: %q", js)
 	}
-	if p.BookmarksBar == nil {
-		t.Error("no BookmarksBar")
+	if _, err := p.BookmarkForUID("BM1").ToJS(); !errors.Is(err, ErrNotBookmarklet) {
+		t.Errorf("ToJS: Expected=ErrNotBookmarklet, Got=%v", err)
 	}
-	if p.BookmarksMenu == nil {
-		t.Error("no BookmarksMenu")
+
+	host, err := p.BookmarkForUID("BM1").Hostname()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if p.ReadingList == nil {
-		t.Error("no ReadingList")
+	if host != "www.example.com" {
+		t.Errorf("Bad hostname: %q", host)
+	}
+}
+
+// TestParserFolders tests that folders are populated.
+func TestParserFolders(t *testing.T) {
+	parsers, cleanup := testParsers(t)
+	defer cleanup()
+	for name, p := range parsers {
+		if len(p.Folders) != 4 {
+			t.Errorf("%s: Expected 4 Folders, got %d", name, len(p.Folders))
+		}
+		if p.BookmarksBar == nil || !p.BookmarksBar.IsBookmarksBar() {
+			t.Errorf("%s: no BookmarksBar", name)
+		}
+		if p.BookmarksMenu == nil || !p.BookmarksMenu.IsBookmarksMenu() {
+			t.Errorf("%s: no BookmarksMenu", name)
+		}
+		if p.ReadingList == nil || !p.ReadingList.IsReadingList() {
+			t.Errorf("%s: no ReadingList", name)
+		}
+		if f := p.FolderForUID("WORK"); f == nil || f.Title() != "Work" || len(f.Bookmarks) != 1 {
+			t.Errorf("%s: Bad folder WORK: %v", name, f)
+		}
+		if p.TypeForUID("WORK") != TypeFolder || p.TypeForUID("BM1") != TypeBookmark {
+			t.Errorf("%s: Bad types", name)
+		}
 	}
 }
 
 // TestUIDMaps tests that uid2XYZ maps are populated
 func TestUIDMaps(t *testing.T) {
-	p, err := New()
-	if err != nil {
-		t.Fatalf("Error reading Bookmarks.plist: %v", err)
-	}
+	parsers, cleanup := testParsers(t)
+	defer cleanup()
+	p := parsers[fixtures.BookmarksFile]
 
 	if len(p.uid2Folder) != len(p.Folders) {
 		t.Errorf("p.uid2Folder and p.Folders have different sizes: %d vs %d",
@@ -94,3 +170,10 @@ func TestUIDMaps(t *testing.T) {
 		}
 	}
 }
+
+// TestMissingFile tests that a missing Bookmarks.plist returns ErrNotFound.
+func TestMissingFile(t *testing.T) {
+	if _, err := New(BookmarksPath("/does/not/exist.plist")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected=ErrNotFound, Got=%v", err)
+	}
+}
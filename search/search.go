@@ -0,0 +1,192 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+// Package search searches Safari's open tabs, bookmarks, Reading List,
+// history and iCloud Tabs with a single query.
+//
+// A Searcher queries each source concurrently, with a timeout per source,
+// and merges the results into a single list of Results ordered by Score.
+// If some sources fail or time out, the results from the others are still
+// returned, along with an Errors describing the failures.
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the default maximum time a Searcher waits for each source.
+var DefaultTimeout = 2 * time.Second
+
+// Source is a type of Safari data.
+type Source string
+
+// Valid Sources.
+const (
+	SourceTabs        Source = "tabs"
+	SourceBookmarks   Source = "bookmarks"
+	SourceReadingList Source = "readinglist"
+	SourceHistory     Source = "history"
+	SourceCloudTabs   Source = "cloud-tabs"
+)
+
+// Result is a search result from any Source.
+type Result struct {
+	Source Source  `json:"source"`
+	Title  string  `json:"title"`
+	URL    string  `json:"url"`
+	Score  float64 `json:"score"` // How well the result matches the query, between 0 and 1
+
+	// Payload is the source-specific item: a *safari.Tab, *safari.Bookmark,
+	// *history.Entry or *cloud.Tab. It isn't included in JSON because
+	// bookmarks refer to their folders, which refer to their bookmarks.
+	Payload interface{} `json:"-"`
+}
+
+// Func searches a single Source. It should return all items that match
+// query, most relevant first, and return early if ctx is cancelled.
+// Funcs that don't are abandoned when the Searcher's Timeout expires.
+type Func func(ctx context.Context, query string) ([]*Result, error)
+
+// SourceError is an error from a single Source.
+type SourceError struct {
+	Source Source
+	Err    error
+}
+
+// Error implements error.
+func (e *SourceError) Error() string { return fmt.Sprintf("%s: %v", e.Source, e.Err) }
+
+// Unwrap returns the underlying error.
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// Errors is returned by Searcher.Search if any sources failed.
+type Errors []*SourceError
+
+// Error implements error.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Searcher searches multiple Sources concurrently.
+type Searcher struct {
+	Timeout time.Duration // Maximum time to wait for each source. 0 means no timeout.
+	Limit   int           // Maximum number of results. 0 means no limit.
+
+	sources []Source // Sources in order of registration
+	funcs   map[Source]Func
+}
+
+// New creates a Searcher for the user's Safari data. Bookmarks and the
+// Reading List are re-read on every search, and the default History and
+// CloudTabs are used.
+func New() *Searcher {
+	s := &Searcher{Timeout: DefaultTimeout}
+	s.Register(SourceTabs, Tabs())
+	s.Register(SourceBookmarks, Bookmarks(nil))
+	s.Register(SourceReadingList, ReadingList(nil))
+	s.Register(SourceHistory, History(nil))
+	s.Register(SourceCloudTabs, CloudTabs(nil))
+	return s
+}
+
+// Register sets the Func used to search src, replacing any existing one.
+// When results have the same Score, they are ordered by source, in the
+// order the sources were registered (or passed to Search).
+func (s *Searcher) Register(src Source, fn Func) {
+	if s.funcs == nil {
+		s.funcs = map[Source]Func{}
+	}
+	if _, ok := s.funcs[src]; !ok {
+		s.sources = append(s.sources, src)
+	}
+	s.funcs[src] = fn
+}
+
+// Sources returns the registered Sources.
+func (s *Searcher) Sources() []Source {
+	return append([]Source{}, s.sources...)
+}
+
+// Search searches sources for query. If no sources are specified, all
+// registered sources are searched. Results are ordered by Score. An empty
+// query matches nothing.
+//
+// If any sources fail or time out, Search returns the results from the
+// other sources and an Errors.
+func (s *Searcher) Search(ctx context.Context, query string, sources ...Source) ([]*Result, error) {
+	if len(sources) == 0 {
+		sources = s.sources
+	}
+	for _, src := range sources {
+		if _, ok := s.funcs[src]; !ok {
+			return nil, fmt.Errorf("unknown source: %s", src)
+		}
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	type reply struct {
+		results []*Result
+		err     error
+	}
+	replies := make([]chan reply, len(sources))
+	for i, src := range sources {
+		replies[i] = make(chan reply, 1)
+		go func(fn Func, ch chan reply) {
+			ctx, cancel := s.context(ctx)
+			defer cancel()
+
+			// Buffered, so fn's goroutine exits even if it's abandoned
+			done := make(chan reply, 1)
+			go func() {
+				r, err := fn(ctx, query)
+				done <- reply{r, err}
+			}()
+			select {
+			case r := <-done:
+				ch <- r
+			case <-ctx.Done():
+				ch <- reply{nil, ctx.Err()}
+			}
+		}(s.funcs[src], replies[i])
+	}
+
+	var (
+		results []*Result
+		errs    Errors
+	)
+	for i, ch := range replies {
+		r := <-ch
+		if r.err != nil {
+			errs = append(errs, &SourceError{sources[i], r.err})
+			continue
+		}
+		results = append(results, r.results...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if s.Limit > 0 && len(results) > s.Limit {
+		results = results[:s.Limit]
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// context returns a Context for searching a single source.
+func (s *Searcher) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(ctx, s.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
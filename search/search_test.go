@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// staticFunc returns a Func that returns results with the given scores.
+func staticFunc(src Source, scores ...float64) Func {
+	return func(ctx context.Context, query string) ([]*Result, error) {
+		var results []*Result
+		for _, sc := range scores {
+			results = append(results, &Result{Source: src, Title: query, Score: sc})
+		}
+		return results, nil
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := &Searcher{}
+	s.Register("a", staticFunc("a", 0.5, 0.25))
+	s.Register("b", staticFunc("b", 1, 0.5))
+	s.Register("c", staticFunc("c"))
+
+	results, err := s.Search(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		x   = []Source{"b", "a", "b", "a"}
+		got []Source
+	)
+	for _, r := range results {
+		got = append(got, r.Source)
+	}
+	if len(got) != len(x) {
+		t.Fatalf("bad no. of results. Expected=%d, Got=%d", len(x), len(got))
+	}
+	for i, src := range x {
+		if got[i] != src {
+			t.Errorf("bad order. Expected=%v, Got=%v", x, got)
+			break
+		}
+	}
+
+	// Specific sources
+	results, err = s.Search(context.Background(), "test", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("bad no. of results. Expected=2, Got=%d", len(results))
+	}
+
+	// Limit
+	s.Limit = 3
+	results, err = s.Search(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("bad no. of results. Expected=3, Got=%d", len(results))
+	}
+
+	// Empty query
+	results, err = s.Search(context.Background(), "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("empty query returned %d results", len(results))
+	}
+
+	// Unknown source
+	if _, err := s.Search(context.Background(), "test", "d"); err == nil {
+		t.Error("searched unknown source")
+	}
+}
+
+// TestSearchErrors tests that failed and slow sources don't prevent
+// results being returned from the others.
+func TestSearchErrors(t *testing.T) {
+	var (
+		errTest = errors.New("test error")
+		block   = make(chan struct{})
+	)
+	defer close(block)
+
+	s := &Searcher{Timeout: 50 * time.Millisecond}
+	s.Register("ok", staticFunc("ok", 1))
+	s.Register("fail", func(ctx context.Context, query string) ([]*Result, error) {
+		return nil, errTest
+	})
+	// Ignores ctx, so must be abandoned
+	s.Register("slow", func(ctx context.Context, query string) ([]*Result, error) {
+		<-block
+		return nil, nil
+	})
+
+	start := time.Now()
+	results, err := s.Search(context.Background(), "test")
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("search took too long: %v", d)
+	}
+	if len(results) != 1 {
+		t.Errorf("bad no. of results. Expected=1, Got=%d", len(results))
+	}
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("bad error type: %T", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("bad no. of errors. Expected=2, Got=%d", len(errs))
+	}
+	if errs[0].Source != "fail" || !errors.Is(errs[0], errTest) {
+		t.Errorf("bad error: %v", errs[0])
+	}
+	if errs[1].Source != "slow" || !errors.Is(errs[1], context.DeadlineExceeded) {
+		t.Errorf("bad error: %v", errs[1])
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package search
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	safari "github.com/deanishe/go-safari"
+	"github.com/deanishe/go-safari/cloud"
+	"github.com/deanishe/go-safari/history"
+	"github.com/deanishe/go-safari/internal/match"
+)
+
+// Tabs returns a Func that searches the titles and URLs of open tabs.
+func Tabs() Func {
+	return func(ctx context.Context, query string) ([]*Result, error) {
+		wins, err := safari.WindowsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			words   = strings.Fields(query)
+			results []*Result
+		)
+		for _, w := range wins {
+			for _, t := range w.Tabs {
+				if sc := score(words, t.Title, t.URL); sc > 0 {
+					results = append(results, &Result{SourceTabs, t.Title, t.URL, sc, t})
+				}
+			}
+		}
+		return results, nil
+	}
+}
+
+// Bookmarks returns a Func that searches the titles and URLs of bookmarks
+// in p. If p is nil, the default Bookmarks.plist is read on each search.
+func Bookmarks(p *safari.Parser) Func {
+	return bookmarks(p, SourceBookmarks)
+}
+
+// ReadingList returns a Func that searches the titles and URLs of Reading
+// List items in p. If p is nil, the default Bookmarks.plist is read on
+// each search.
+func ReadingList(p *safari.Parser) Func {
+	return bookmarks(p, SourceReadingList)
+}
+
+// bookmarks returns a Func that searches bookmarks or Reading List items.
+func bookmarks(p *safari.Parser, src Source) Func {
+	return func(ctx context.Context, query string) ([]*Result, error) {
+		p := p
+		if p == nil {
+			var err error
+			if p, err = safari.New(); err != nil {
+				return nil, err
+			}
+		}
+		bms := p.Bookmarks
+		if src == SourceReadingList {
+			bms = p.BookmarksRL
+		}
+
+		var (
+			words   = strings.Fields(query)
+			results []*Result
+		)
+		for _, bm := range bms {
+			if sc := score(words, bm.Title(), bm.URL); sc > 0 {
+				results = append(results, &Result{src, bm.Title(), bm.URL, sc, bm})
+			}
+		}
+		return results, nil
+	}
+}
+
+// History returns a Func that searches h with History.SearchRanked.
+// If h is nil, the default History is used.
+func History(h *history.History) Func {
+	return func(ctx context.Context, query string) ([]*Result, error) {
+		h := h
+		if h == nil {
+			var err error
+			if h, err = history.Default(); err != nil {
+				return nil, err
+			}
+		}
+		entries, err := h.SearchRankedContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			words   = strings.Fields(query)
+			results []*Result
+		)
+		for _, e := range entries {
+			if sc := score(words, e.Title, e.URL); sc > 0 {
+				results = append(results, &Result{SourceHistory, e.Title, e.URL, sc, e})
+			}
+		}
+		return results, nil
+	}
+}
+
+// CloudTabs returns a Func that searches the titles and URLs of the tabs
+// in c. If c is nil, the default CloudTabs is used.
+func CloudTabs(c *cloud.CloudTabs) Func {
+	return func(ctx context.Context, query string) ([]*Result, error) {
+		c := c
+		if c == nil {
+			var err error
+			if c, err = cloud.Default(); err != nil {
+				return nil, err
+			}
+		}
+		tabs, err := c.TabsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			words   = strings.Fields(query)
+			results []*Result
+		)
+		for _, t := range tabs {
+			if sc := score(words, t.Title, t.URL); sc > 0 {
+				results = append(results, &Result{SourceCloudTabs, t.Title, t.URL, sc, t})
+			}
+		}
+		return results, nil
+	}
+}
+
+// score returns how well title and URL match words, between 0 and 1.
+// It returns 0 if any word is in neither title nor URL.
+//
+// Each word scores 1 if it matches the start of the hostname, 0.75 if it
+// matches the start of a word in the title, and 0.5 if it occurs anywhere
+// else. The score is the average for all words.
+func score(words []string, title, URL string) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+
+	var (
+		host   string
+		lTitle = strings.ToLower(title)
+		lURL   = strings.ToLower(URL)
+		fields = match.Words(title)
+		total  float64
+	)
+	if u, err := url.Parse(lURL); err == nil {
+		host = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+
+	for _, w := range words {
+		w = strings.ToLower(w)
+		switch {
+		case host != "" && strings.HasPrefix(host, w):
+			total += 1
+		case match.HasPrefix(fields, w):
+			total += 0.75
+		case strings.Contains(lTitle, w) || strings.Contains(lURL, w):
+			total += 0.5
+		default:
+			return 0
+		}
+	}
+	return total / float64(len(words))
+}
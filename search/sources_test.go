@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package search
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	safari "github.com/deanishe/go-safari"
+	"github.com/deanishe/go-safari/cloud"
+	"github.com/deanishe/go-safari/history"
+	"github.com/deanishe/go-safari/internal/fixtures"
+)
+
+// testSearcher returns a Searcher for the fixtures and a fake Backend.
+func testSearcher(t *testing.T) (*Searcher, func()) {
+	dir, cleanup := fixtures.Dir(t)
+
+	p, err := safari.New(safari.BookmarksPath(filepath.Join(dir, fixtures.BookmarksFile)))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	h, err := history.New(filepath.Join(dir, fixtures.HistoryFile))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	c, err := cloud.New(filepath.Join(dir, fixtures.CloudTabsFile))
+	if err != nil {
+		h.DB.Close()
+		cleanup()
+		t.Fatal(err)
+	}
+	c.LocalDevice = fixtures.LocalDevice
+
+	prev := safari.CurrentBackend()
+	safari.SetBackend(safari.NewFakeBackend(
+		&safari.FakeWindow{Tabs: []*safari.FakeTab{
+			{Title: "Home - Wiki", URL: "https://wiki.example.com/Home"},
+			{Title: "Google", URL: "https://www.google.com/"},
+		}},
+	))
+
+	s := &Searcher{}
+	s.Register(SourceTabs, Tabs())
+	s.Register(SourceBookmarks, Bookmarks(p))
+	s.Register(SourceReadingList, ReadingList(p))
+	s.Register(SourceHistory, History(h))
+	s.Register(SourceCloudTabs, CloudTabs(c))
+
+	return s, func() {
+		safari.SetBackend(prev)
+		h.DB.Close()
+		c.DB.Close()
+		cleanup()
+	}
+}
+
+func TestSources(t *testing.T) {
+	s, cleanup := testSearcher(t)
+	defer cleanup()
+
+	tests := []struct {
+		q       string
+		sources map[Source]int
+	}{
+		{"wiki", map[Source]int{SourceTabs: 1, SourceBookmarks: 1, SourceHistory: 2, SourceCloudTabs: 1}},
+		{"wiki home", map[Source]int{SourceTabs: 1, SourceHistory: 1}},
+		{"post", map[Source]int{SourceReadingList: 2}},
+		{"new post", map[Source]int{SourceReadingList: 1}},
+		{"golang", map[Source]int{SourceHistory: 2, SourceCloudTabs: 1}},
+		{"local", map[Source]int{}},
+		{"nothing", map[Source]int{}},
+	}
+
+	for _, td := range tests {
+		results, err := s.Search(context.Background(), td.q)
+		if err != nil {
+			t.Errorf("search for '%s' failed: %v", td.q, err)
+			continue
+		}
+		got := map[Source]int{}
+		for _, r := range results {
+			got[r.Source]++
+			if r.Payload == nil {
+				t.Errorf("result %q has no payload", r.Title)
+			}
+		}
+		for _, src := range s.Sources() {
+			if got[src] != td.sources[src] {
+				t.Errorf("bad no. of %s results for '%s'. Expected=%d, Got=%d", src, td.q, td.sources[src], got[src])
+			}
+		}
+	}
+
+	// Payloads have source-specific types
+	results, err := s.Search(context.Background(), "wiki home", SourceTabs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("bad no. of results. Expected=1, Got=%d", len(results))
+	}
+	if tab, ok := results[0].Payload.(*safari.Tab); !ok || tab.Index != 1 {
+		t.Errorf("bad payload: %#v", results[0].Payload)
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		words      []string
+		title, URL string
+		x          float64
+	}{
+		{nil, "Google", "https://www.google.com/", 0},
+		{[]string{"goo"}, "Google", "https://www.google.com/", 1},
+		{[]string{"Search"}, "golang - Google Search", "https://www.google.com/search?q=golang", 0.75},
+		{[]string{"oogle"}, "Google", "https://www.google.com/", 0.5},
+		{[]string{"goo", "oogle"}, "Google", "https://www.google.com/", 0.75},
+		{[]string{"goo", "bing"}, "Google", "https://www.google.com/", 0},
+		{[]string{"alert"}, "Bookmarklet", "javascript:alert(1)", 0.5},
+	}
+	for _, td := range tests {
+		v := score(td.words, td.title, td.URL)
+		if v != td.x {
+			t.Errorf("bad score for %v. Expected=%v, Got=%v", td.words, td.x, v)
+		}
+	}
+}
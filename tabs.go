@@ -9,35 +9,214 @@
 package safari
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"os/exec"
 
 	"github.com/deanishe/deputy"
+
+	"github.com/deanishe/go-safari/internal/errs"
 )
 
 // Tab is a Safari tab.
+//
+// WindowIndex and Index change whenever a window is brought to the front
+// or a tab is closed, so Tab's methods first look the tab up by ID and
+// update them.
 type Tab struct {
 	Index       int
 	WindowIndex int
 	Title       string
 	URL         string
 	Active      bool
+
+	// ID identifies the tab across calls. It is Safari's ID for the tab
+	// if Safari provides one, otherwise it is derived from the window's ID
+	// and the tab's URL and title, and so changes if the tab navigates to
+	// another page. Tabs in the same window with the same URL and title
+	// have the same ID; the one nearest the tab's last-known position is
+	// assumed to be the right one.
+	//
+	// If ID is empty, WindowIndex and Index are used as they are.
+	ID string
+	// WindowID is Safari's ID for the tab's window.
+	WindowID int
 }
 
 // RunJS executes JavaScript in this tab.
 func (t *Tab) RunJS(js string) error {
-	_, err := runJXA(jsRunJavaScript, fmt.Sprintf("%d", t.WindowIndex),
-		fmt.Sprintf("%d", t.Index), js)
-	return err
+	return t.RunJSContext(context.Background(), js)
+}
+
+// RunJSContext executes JavaScript in this tab. The script is aborted if ctx
+// is cancelled.
+func (t *Tab) RunJSContext(ctx context.Context, js string) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	return backend.RunJS(ctx, t.WindowIndex, t.Index, js)
+}
+
+// EvalJS evaluates JavaScript expression js in this tab and unmarshals its
+// value into target with json.Unmarshal. If target is nil, the value is
+// discarded. The value must be serialisable with JSON.stringify; undefined
+// becomes null. Wrap statements in a function expression, e.g.
+//
+//	(function() { var links = document.links; return links.length })()
+//
+// If js throws an exception, EvalJS returns a *JSError. If Safari's "Allow
+// JavaScript from Apple Events" setting is off, it returns ErrJSDisabled.
+func (t *Tab) EvalJS(js string, target interface{}) error {
+	return t.EvalJSContext(context.Background(), js, target)
+}
+
+// EvalJSContext is like EvalJS, but aborts if ctx is cancelled.
+func (t *Tab) EvalJSContext(ctx context.Context, js string, target interface{}) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	data, err := backend.EvalJS(ctx, t.WindowIndex, t.Index, js)
+	if err != nil || target == nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
 }
 
 // Activate activates this tab.
 func (t *Tab) Activate() error {
-	if t.Active {
+	return t.ActivateContext(context.Background())
+}
+
+// ActivateContext activates this tab, aborting if ctx is cancelled.
+func (t *Tab) ActivateContext(ctx context.Context) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	if t.Active && t.WindowIndex == 1 {
 		return nil
 	}
-	return Activate(t.WindowIndex, t.Index)
+	if err := ActivateContext(ctx, t.WindowIndex, t.Index); err != nil {
+		return err
+	}
+	t.WindowIndex, t.Active = 1, true
+	return nil
+}
+
+// Navigate loads URL in this tab.
+//
+// If Safari doesn't provide tab IDs, the tab's ID is derived from its URL
+// and title, and so is cleared by Navigate, Back and Forward. The tab's
+// methods then use WindowIndex and Index as they are.
+func (t *Tab) Navigate(URL string) error {
+	return t.NavigateContext(context.Background(), URL)
+}
+
+// NavigateContext is like Navigate, but aborts if ctx is cancelled.
+func (t *Tab) NavigateContext(ctx context.Context, URL string) error {
+	if err := t.navigate(ctx, NavGo, URL); err != nil {
+		return err
+	}
+	t.URL, t.Title = URL, ""
+	return nil
+}
+
+// Reload reloads this tab. It requires Safari's "Allow JavaScript from
+// Apple Events" setting.
+func (t *Tab) Reload() error { return t.ReloadContext(context.Background()) }
+
+// ReloadContext is like Reload, but aborts if ctx is cancelled.
+func (t *Tab) ReloadContext(ctx context.Context) error { return t.navigate(ctx, NavReload, "") }
+
+// Back goes back in this tab's history. It requires Safari's "Allow
+// JavaScript from Apple Events" setting.
+func (t *Tab) Back() error { return t.BackContext(context.Background()) }
+
+// BackContext is like Back, but aborts if ctx is cancelled.
+func (t *Tab) BackContext(ctx context.Context) error { return t.navigate(ctx, NavBack, "") }
+
+// Forward goes forward in this tab's history. It requires Safari's "Allow
+// JavaScript from Apple Events" setting.
+func (t *Tab) Forward() error { return t.ForwardContext(context.Background()) }
+
+// ForwardContext is like Forward, but aborts if ctx is cancelled.
+func (t *Tab) ForwardContext(ctx context.Context) error { return t.navigate(ctx, NavForward, "") }
+
+// Stop stops this tab loading. It requires Safari's "Allow JavaScript from
+// Apple Events" setting.
+func (t *Tab) Stop() error { return t.StopContext(context.Background()) }
+
+// StopContext is like Stop, but aborts if ctx is cancelled.
+func (t *Tab) StopContext(ctx context.Context) error { return t.navigate(ctx, NavStop, "") }
+
+// navigate performs action in this tab. It clears a derived ID if action
+// changes the tab's URL.
+func (t *Tab) navigate(ctx context.Context, action NavAction, URL string) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	if err := backend.Navigate(ctx, action, t.WindowIndex, t.Index, URL); err != nil {
+		return err
+	}
+	if action != NavReload && action != NavStop && t.ID == derivedID(t) {
+		t.ID = ""
+	}
+	return nil
+}
+
+// Close closes this tab.
+func (t *Tab) Close() error {
+	return t.CloseContext(context.Background())
+}
+
+// CloseContext closes this tab, aborting if ctx is cancelled.
+func (t *Tab) CloseContext(ctx context.Context) error {
+	if err := t.resolve(ctx); err != nil {
+		return err
+	}
+	return closeStuff(ctx, TargetTab, t.WindowIndex, t.Index)
+}
+
+// resolve updates the tab's WindowIndex, Index and Active from Safari's
+// current windows. It returns ErrNoSuchTab if no tab has the tab's ID.
+func (t *Tab) resolve(ctx context.Context) error {
+	if t.ID == "" {
+		return nil
+	}
+	// Safari's current windows, not cached ones
+	wins, err := windows(ctx, uncached(backend))
+	if err != nil {
+		return err
+	}
+	return t.resolveIn(wins)
+}
+
+// resolveIn updates the tab's position to that of the tab in wins with
+// the same ID. If there are several, the one nearest the tab's previous
+// position is chosen.
+func (t *Tab) resolveIn(wins []*Window) error {
+	var (
+		match *Tab
+		best  int
+	)
+	for _, w := range wins {
+		for _, tab := range w.Tabs {
+			if tab.ID != t.ID {
+				continue
+			}
+			d := 1000*abs(tab.WindowIndex-t.WindowIndex) + abs(tab.Index-t.Index)
+			if match == nil || d < best {
+				match, best = tab, d
+			}
+		}
+	}
+	if match == nil {
+		return fmt.Errorf("%w: %q (%s)", ErrNoSuchTab, t.Title, t.URL)
+	}
+	t.WindowIndex, t.Index, t.Active = match.WindowIndex, match.Index, match.Active
+	return nil
 }
 
 // Window is a Safari window.
@@ -45,6 +224,29 @@ type Window struct {
 	Index     int
 	ActiveTab int
 	Tabs      []*Tab
+	ID        int // Safari's ID for the window
+}
+
+// setIDs sets the ID of tabs that don't have one.
+func setIDs(tabs ...*Tab) {
+	for _, t := range tabs {
+		if t.ID == "" {
+			t.ID = derivedID(t)
+		}
+	}
+}
+
+// derivedID returns an ID for t based on its window's ID, URL and title.
+func derivedID(t *Tab) string {
+	return fmt.Sprintf("%d:%08x", t.WindowID, crc32.ChecksumIEEE([]byte(t.URL+"\x00"+t.Title)))
+}
+
+// abs returns the absolute value of n.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
 // Windows returns information about Safari's open windows.
@@ -52,13 +254,30 @@ type Window struct {
 // NOTE: This function takes a long time (~0.5 seconds) to complete as
 // it calls Safari via the Scripting Bridge, which is slow as shit.
 //
-// You would be wise to cache these data for a few seconds.
-func Windows() ([]*Window, error) {
-	wins := []*Window{}
+// You would be wise to cache these data for a few seconds with a
+// CachedBackend, or to use a Worker, which avoids the cost of starting
+// osascript.
+func Windows() ([]*Window, error) { return WindowsContext(context.Background()) }
+
+// WindowsContext is like Windows, but aborts if ctx is cancelled.
+func WindowsContext(ctx context.Context) ([]*Window, error) {
+	return windows(ctx, backend)
+}
 
-	if err := runJXA2JSON(jsGetTabs, &wins); err != nil {
+// windows returns b's windows and sets the IDs of their tabs.
+func windows(ctx context.Context, b Backend) ([]*Window, error) {
+	wins, err := b.Windows(ctx)
+	if err != nil {
 		return nil, err
 	}
+	for _, w := range wins {
+		for _, t := range w.Tabs {
+			if t.WindowID == 0 {
+				t.WindowID = w.ID
+			}
+		}
+		setIDs(w.Tabs...)
+	}
 	return wins, nil
 }
 
@@ -66,28 +285,25 @@ func Windows() ([]*Window, error) {
 //
 // NOTE: This function calls Safari via the Scripting Bridge, so it's
 // quite slow.
-func ActiveTab() (*Tab, error) {
-	tab := &Tab{}
+func ActiveTab() (*Tab, error) { return ActiveTabContext(context.Background()) }
 
-	if err := runJXA2JSON(jsGetCurrentTab, &tab); err != nil {
+// ActiveTabContext is like ActiveTab, but aborts if ctx is cancelled.
+func ActiveTabContext(ctx context.Context) (*Tab, error) {
+	tab, err := backend.ActiveTab(ctx)
+	if err != nil {
 		return nil, err
 	}
+	setIDs(tab)
 	return tab, nil
 }
 
 // Activate activates the specified Safari window (and tab). If tab is 0,
 // the active tab will not be changed.
-func Activate(win, tab int) error {
-
-	args := []string{fmt.Sprintf("%d", win)}
-	if tab > 0 {
-		args = append(args, fmt.Sprintf("%d", tab))
-	}
+func Activate(win, tab int) error { return ActivateContext(context.Background(), win, tab) }
 
-	if _, err := runJXA(jsActivate, args...); err != nil {
-		return err
-	}
-	return nil
+// ActivateContext is like Activate, but aborts if ctx is cancelled.
+func ActivateContext(ctx context.Context, win, tab int) error {
+	return backend.Activate(ctx, win, tab)
 }
 
 // ActivateTab activates the specified tab.
@@ -95,54 +311,184 @@ func ActivateTab(win, tab int) error {
 	return Activate(win, tab)
 }
 
+// ActivateTabContext is like ActivateTab, but aborts if ctx is cancelled.
+func ActivateTabContext(ctx context.Context, win, tab int) error {
+	return ActivateContext(ctx, win, tab)
+}
+
 // ActivateWin activates the specified window.
 func ActivateWin(win int) error {
 	return Activate(win, 0)
 }
 
-// closeStuff runs script jsClose with the given arguments.
-func closeStuff(what string, win, tab int) error {
+// ActivateWinContext is like ActivateWin, but aborts if ctx is cancelled.
+func ActivateWinContext(ctx context.Context, win int) error {
+	return ActivateContext(ctx, win, 0)
+}
 
+// closeStuff closes the given target via the current Backend.
+func closeStuff(ctx context.Context, what CloseTarget, win, tab int) error {
 	if win == 0 { // Default to frontmost window
 		win = 1
 	}
-	args := []string{what, fmt.Sprintf("%d", win)}
-
-	if tab > 0 {
-		args = append(args, fmt.Sprintf("%d", tab))
-	}
-
-	if _, err := runJXA(jsClose, args...); err != nil {
-		return err
-	}
-
-	return nil
+	return backend.Close(ctx, what, win, tab)
 }
 
 // Close closes the specified tab.
 // If win is 0, the frontmost window is assumed. If tab is 0, current tab is
 // assumed.
-func Close(win, tab int) error { return closeStuff("tab", win, tab) }
+func Close(win, tab int) error { return CloseContext(context.Background(), win, tab) }
+
+// CloseContext is like Close, but aborts if ctx is cancelled.
+func CloseContext(ctx context.Context, win, tab int) error {
+	return closeStuff(ctx, TargetTab, win, tab)
+}
 
 // CloseWin closes the specified window. If win is 0, the frontmost window is closed.
-func CloseWin(win int) error { return closeStuff("win", win, 0) }
+func CloseWin(win int) error { return CloseWinContext(context.Background(), win) }
+
+// CloseWinContext is like CloseWin, but aborts if ctx is cancelled.
+func CloseWinContext(ctx context.Context, win int) error {
+	return closeStuff(ctx, TargetWin, win, 0)
+}
 
 // CloseTab closes the specified tab. If win is 0, frontmost window is assumed.
 // If tab is 0, current tab is closed.
-func CloseTab(win, tab int) error { return closeStuff("tab", win, tab) }
+func CloseTab(win, tab int) error { return CloseTabContext(context.Background(), win, tab) }
+
+// CloseTabContext is like CloseTab, but aborts if ctx is cancelled.
+func CloseTabContext(ctx context.Context, win, tab int) error {
+	return closeStuff(ctx, TargetTab, win, tab)
+}
 
 // CloseTabsOther closes all other tabs in win.
-func CloseTabsOther(win, tab int) error { return closeStuff("tabs-other", win, tab) }
+func CloseTabsOther(win, tab int) error { return CloseTabsOtherContext(context.Background(), win, tab) }
+
+// CloseTabsOtherContext is like CloseTabsOther, but aborts if ctx is cancelled.
+func CloseTabsOtherContext(ctx context.Context, win, tab int) error {
+	return closeStuff(ctx, TargetTabsOther, win, tab)
+}
 
 // CloseTabsLeft closes tabs to the left of the specified one.
-func CloseTabsLeft(win, tab int) error { return closeStuff("tabs-left", win, tab) }
+func CloseTabsLeft(win, tab int) error { return CloseTabsLeftContext(context.Background(), win, tab) }
+
+// CloseTabsLeftContext is like CloseTabsLeft, but aborts if ctx is cancelled.
+func CloseTabsLeftContext(ctx context.Context, win, tab int) error {
+	return closeStuff(ctx, TargetTabsLeft, win, tab)
+}
 
 // CloseTabsRight closes tabs to the right of the specified one.
-func CloseTabsRight(win, tab int) error { return closeStuff("tabs-right", win, tab) }
+func CloseTabsRight(win, tab int) error { return CloseTabsRightContext(context.Background(), win, tab) }
+
+// CloseTabsRightContext is like CloseTabsRight, but aborts if ctx is cancelled.
+func CloseTabsRightContext(ctx context.Context, win, tab int) error {
+	return closeStuff(ctx, TargetTabsRight, win, tab)
+}
+
+// TabsWhere returns all tabs, in all windows, for which match returns true.
+// match is called once for each tab, in window and tab order, so it may
+// keep state, e.g. to match duplicate tabs.
+func TabsWhere(match func(*Tab) bool) ([]*Tab, error) {
+	return TabsWhereContext(context.Background(), match)
+}
+
+// TabsWhereContext is like TabsWhere, but aborts if ctx is cancelled.
+func TabsWhereContext(ctx context.Context, match func(*Tab) bool) ([]*Tab, error) {
+	return tabsWhere(ctx, backend, match)
+}
+
+// tabsWhere returns the tabs in b's windows for which match returns true.
+func tabsWhere(ctx context.Context, b Backend, match func(*Tab) bool) ([]*Tab, error) {
+	wins, err := windows(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	return matchTabs(wins, match), nil
+}
+
+// matchTabs returns the tabs in wins for which match returns true.
+func matchTabs(wins []*Window, match func(*Tab) bool) []*Tab {
+	tabs := []*Tab{}
+	for _, w := range wins {
+		for _, t := range w.Tabs {
+			if match(t) {
+				tabs = append(tabs, t)
+			}
+		}
+	}
+	return tabs
+}
+
+// tabAt returns true if the tab at t's position in wins is t.
+func tabAt(wins []*Window, t *Tab) bool {
+	for _, w := range wins {
+		if w.Index == t.WindowIndex {
+			return t.Index >= 1 && t.Index <= len(w.Tabs) && w.Tabs[t.Index-1].ID == t.ID
+		}
+	}
+	return false
+}
+
+// CloseTabsWhere closes all tabs, in all windows, for which match returns
+// true, and returns the closed tabs. match is called as by TabsWhere.
+// Windows whose tabs are all closed are also closed.
+//
+// Safari's windows are listed again before the tabs in each window are
+// closed, and if a tab isn't where it's expected to be, so tabs opened,
+// closed or moved in the meantime don't cause the wrong tabs to be closed.
+// Matching tabs that no longer exist are skipped.
+//
+// If an error occurs, the tabs closed so far are returned with it.
+func CloseTabsWhere(match func(*Tab) bool) ([]*Tab, error) {
+	return CloseTabsWhereContext(context.Background(), match)
+}
+
+// CloseTabsWhereContext is like CloseTabsWhere, but aborts if ctx is
+// cancelled.
+func CloseTabsWhereContext(ctx context.Context, match func(*Tab) bool) ([]*Tab, error) {
+	wins, err := windows(ctx, uncached(backend))
+	if err != nil {
+		return nil, err
+	}
+	tabs := matchTabs(wins, match)
+
+	// Close last tab first, so that if nothing else changes, closing a tab
+	// (or window) doesn't move the tabs still to be closed, and wins stays
+	// correct for them.
+	var (
+		closed = []*Tab{}
+		win    int // window wins was listed for
+	)
+	if len(tabs) > 0 {
+		win = tabs[len(tabs)-1].WindowIndex
+	}
+	for i := len(tabs) - 1; i >= 0; i-- {
+		t := tabs[i]
+		if t.WindowIndex != win || !tabAt(wins, t) {
+			if wins, err = windows(ctx, uncached(backend)); err != nil {
+				return closed, err
+			}
+			if err := t.resolveIn(wins); err != nil {
+				if errors.Is(err, ErrNoSuchTab) { // already closed
+					continue
+				}
+				return closed, err
+			}
+			win = t.WindowIndex
+		}
+		if err := backend.Close(ctx, TargetTab, t.WindowIndex, t.Index); err != nil {
+			return closed, err
+		}
+		closed = append([]*Tab{t}, closed...)
+	}
+	return closed, nil
+}
 
 // runJXA executes JavaScript script with /usr/bin/osascript and returns the
-// script's output on STDOUT.
-func runJXA(script string, argv ...string) ([]byte, error) {
+// script's output on STDOUT. Errors are mapped onto the package's Err* values
+// where possible. If ctx is cancelled, osascript is killed and ctx.Err()
+// is returned.
+func runJXA(ctx context.Context, script string, argv ...string) ([]byte, error) {
 
 	data := []byte{}
 
@@ -158,24 +504,12 @@ func runJXA(script string, argv ...string) ([]byte, error) {
 		args = append(args, argv...)
 	}
 
-	if err := d.Run(exec.Command(cmd, args...)); err != nil {
-		return data, err
+	if err := d.Run(exec.CommandContext(ctx, cmd, args...)); err != nil {
+		if ctx.Err() != nil {
+			return data, ctx.Err()
+		}
+		return data, errs.OSAScript(err)
 	}
 
 	return data, nil
 }
-
-// runJXA2JSON executes a JXA script and unmarshals its output to target using
-// json.Unmarshal()
-func runJXA2JSON(script string, target interface{}, argv ...string) error {
-	data, err := runJXA(script, argv...)
-	if err != nil {
-		return err
-	}
-
-	if err := json.Unmarshal(data, target); err != nil {
-		return err
-	}
-
-	return nil
-}
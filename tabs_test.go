@@ -8,10 +8,18 @@
 
 package safari
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
 
 // TestWindows tests that Safari windows and tabs are correctly read.
 func TestWindows(t *testing.T) {
+	_, restore := newTestBackend()
+	defer restore()
+
 	wins, err := Windows()
 	if err != nil {
 		t.Fatalf("Error getting Safari windows: %v", err)
@@ -43,6 +51,437 @@ func TestWindows(t *testing.T) {
 			if tab.WindowIndex != w.Index {
 				t.Errorf("WindowIndex != w.Index. Expected=%v, Got=%v", w.Index, tab.WindowIndex)
 			}
+			if tab.Active != (tab.Index == w.ActiveTab) {
+				t.Errorf("Tab %dx%d: bad Active", w.Index, tab.Index)
+			}
+		}
+	}
+}
+
+// TestContext tests that cancelled operations return the Context's error
+// and change nothing.
+func TestContext(t *testing.T) {
+	_, restore := newTestBackend()
+	defer restore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	before := layout(t)
+
+	if _, err := WindowsContext(ctx); err != context.Canceled {
+		t.Errorf("WindowsContext: Expected=%v, Got=%v", context.Canceled, err)
+	}
+	if _, err := ActiveTabContext(ctx); err != context.Canceled {
+		t.Errorf("ActiveTabContext: Expected=%v, Got=%v", context.Canceled, err)
+	}
+
+	tab := &Tab{Index: 3, WindowIndex: 1}
+	funcs := map[string]func() error{
+		"ActivateContext":       func() error { return ActivateContext(ctx, 2, 1) },
+		"CloseTabContext":       func() error { return CloseTabContext(ctx, 1, 1) },
+		"CloseWinContext":       func() error { return CloseWinContext(ctx, 1) },
+		"CloseTabsOtherContext": func() error { return CloseTabsOtherContext(ctx, 1, 1) },
+		"Tab.ActivateContext":   func() error { return tab.ActivateContext(ctx) },
+		"Tab.RunJSContext":      func() error { return tab.RunJSContext(ctx, "1") },
+	}
+	for name, fn := range funcs {
+		if err := fn(); err != context.Canceled {
+			t.Errorf("%s: Expected=%v, Got=%v", name, context.Canceled, err)
+		}
+	}
+
+	if after := layout(t); after != before {
+		t.Errorf("cancelled operations changed tabs. Expected=%q, Got=%q", before, after)
+	}
+}
+
+// findTab returns the tab with the given title.
+func findTab(t *testing.T, title string) *Tab {
+	wins, err := Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range wins {
+		for _, tab := range w.Tabs {
+			if tab.Title == title {
+				return tab
+			}
+		}
+	}
+	t.Fatalf("no tab %q", title)
+	return nil
+}
+
+// TestTabIdentity tests that Tab's methods act on the right tab after
+// windows and tabs have moved.
+func TestTabIdentity(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+
+	// IDs are set and unique
+	wins, err := Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, w := range wins {
+		if w.ID == 0 {
+			t.Errorf("window %d has no ID", w.Index)
+		}
+		for _, tab := range w.Tabs {
+			if tab.ID == "" || seen[tab.ID] {
+				t.Errorf("bad ID for tab %q: %q", tab.Title, tab.ID)
+			}
+			if tab.WindowID != w.ID {
+				t.Errorf("bad WindowID. Expected=%d, Got=%d", w.ID, tab.WindowID)
+			}
+			seen[tab.ID] = true
+		}
+	}
+	active, err := ActiveTab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := findTab(t, "b"); active.ID != x.ID {
+		t.Errorf("bad active tab ID. Expected=%q, Got=%q", x.ID, active.ID)
+	}
+
+	d, x := findTab(t, "d"), findTab(t, "x")
+	if err := CloseTab(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ActivateWin(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "b c *d e|*x y" {
+		t.Errorf("activate: Expected=%q, Got=%q", "b c *d e|*x y", s)
+	}
+	if d.WindowIndex != 1 || d.Index != 3 {
+		t.Errorf("bad position. Expected=1x3, Got=%dx%d", d.WindowIndex, d.Index)
+	}
+
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "b c *d e|*y" {
+		t.Errorf("close: Expected=%q, Got=%q", "b c *d e|*y", s)
+	}
+
+	var got string
+	fb.JS = func(tab *FakeTab, js string) error {
+		got = tab.Title
+		return nil
+	}
+	e := findTab(t, "e")
+	if err := CloseTab(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RunJS("void(0)"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "e" {
+		t.Errorf("RunJS: Expected=e, Got=%s", got)
+	}
+
+	// Closed tab
+	if err := x.Close(); !errors.Is(err, ErrNoSuchTab) {
+		t.Errorf("closed tab: Expected=ErrNoSuchTab, Got=%v", err)
+	}
+}
+
+// TestTabIdentityDuplicates tests that tabs with the same URL and title
+// are told apart by position, and that Safari's IDs are preferred.
+func TestTabIdentityDuplicates(t *testing.T) {
+	fb := NewFakeBackend(&FakeWindow{Tabs: fakeTabs("a", "a", "a", "b")})
+	prev := backend
+	SetBackend(fb)
+	defer SetBackend(prev)
+
+	wins, err := Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	third := wins[0].Tabs[2]
+	if err := CloseTab(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := third.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if third.Index != 2 {
+		t.Errorf("bad duplicate. Expected=2, Got=%d", third.Index)
+	}
+
+	// Safari ID survives navigation
+	fb.Wins[0].Tabs[2].ID = "42"
+	b := findTab(t, "b")
+	if b.ID != "42" {
+		t.Errorf("Safari ID not used. Expected=42, Got=%q", b.ID)
+	}
+	fb.Wins[0].Tabs[2].Title = "c"
+	if err := CloseTab(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := layout(t); s != "*a" {
+		t.Errorf("bad layout. Expected=%q, Got=%q", "*a", s)
+	}
+}
+
+func TestEvalJS(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+
+	fb.Eval = func(tab *FakeTab, js string) (interface{}, error) {
+		switch js {
+		case "throw":
+			return nil, &JSError{"Error", "oops"}
+		case "links":
+			return []map[string]string{{"title": tab.Title, "url": tab.URL}}, nil
+		}
+		return nil, nil
+	}
+
+	tab := findTab(t, "c")
+	var links []struct {
+		Title string
+		URL   string
+	}
+	if err := tab.EvalJS("links", &links); err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Title != "c" || links[0].URL != "https://c.example.com/" {
+		t.Errorf("bad result: %#v", links)
+	}
+
+	if err := tab.EvalJS("nothing", nil); err != nil {
+		t.Errorf("nil target: %v", err)
+	}
+
+	var jsErr *JSError
+	if err := tab.EvalJS("throw", &links); !errors.As(err, &jsErr) || jsErr.Message != "oops" {
+		t.Errorf("exception: Expected=JSError, Got=%v", err)
+	}
+}
+
+func TestNavigate(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+
+	// url returns the URL of the tab at 1x2
+	url := func() string { return fb.Wins[0].Tabs[1].URL }
+
+	tab := findTab(t, "b")
+	if err := tab.Navigate("https://one.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if tab.URL != "https://one.example.com/" || tab.ID != "" {
+		t.Errorf("tab not updated: %q, ID=%q", tab.URL, tab.ID)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+		x    string
+	}{
+		{"navigate", func() error { return tab.Navigate("https://two.example.com/") }, "https://two.example.com/"},
+		{"back", tab.Back, "https://one.example.com/"},
+		{"back again", tab.Back, "https://b.example.com/"},
+		{"forward", tab.Forward, "https://one.example.com/"},
+		{"reload", tab.Reload, "https://one.example.com/"},
+		{"stop", tab.Stop, "https://one.example.com/"},
+	}
+	for _, td := range tests {
+		if err := td.fn(); err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			continue
+		}
+		if url() != td.x {
+			t.Errorf("%s: bad URL. Expected=%q, Got=%q", td.name, td.x, url())
+		}
+	}
+	if n := fb.Wins[0].Tabs[1].Reloads; n != 1 {
+		t.Errorf("bad reload count. Expected=1, Got=%d", n)
+	}
+
+	// Safari's IDs are kept
+	fb.Wins[1].Tabs[0].ID = "42"
+	x := findTab(t, "x")
+	if err := x.Navigate("https://three.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Reload(); err != nil || x.ID != "42" {
+		t.Errorf("Safari ID not kept: %q, %v", x.ID, err)
+	}
+}
+
+func TestCloseTabsWhere(t *testing.T) {
+	// in returns a predicate matching the given titles
+	in := func(titles ...string) func(*Tab) bool {
+		return func(tab *Tab) bool {
+			for _, s := range titles {
+				if tab.Title == s {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	tests := []struct {
+		name   string
+		match  func(*Tab) bool
+		closed string
+		x      string
+	}{
+		{"none", in(), "", "a *b c d e|*x y"},
+		{"one", in("c"), "c", "a *b d e|*x y"},
+		{"several", in("a", "c", "e"), "a c e", "*b d|*x y"},
+		{"current", in("b"), "b", "a *c d e|*x y"},
+		{"windows", in("a", "d", "y"), "a d y", "*b c e|*x"},
+		{"whole window", in("a", "b", "c", "d", "e", "y"), "a b c d e y", "*x"},
+		{"all", func(*Tab) bool { return true }, "a b c d e x y", ""},
+	}
+
+	for _, td := range tests {
+		_, restore := newTestBackend()
+		closed, err := CloseTabsWhere(td.match)
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			restore()
+			continue
+		}
+		var titles []string
+		for _, tab := range closed {
+			titles = append(titles, tab.Title)
+		}
+		if s := strings.Join(titles, " "); s != td.closed {
+			t.Errorf("%s: bad closed tabs. Expected=%q, Got=%q", td.name, td.closed, s)
+		}
+		if s := layout(t); s != td.x {
+			t.Errorf("%s: bad layout. Expected=%q, Got=%q", td.name, td.x, s)
+		}
+		restore()
+	}
+
+	// Dry run doesn't close anything; match is called in order
+	_, restore := newTestBackend()
+	defer restore()
+	var seen []string
+	tabs, err := TabsWhere(func(tab *Tab) bool {
+		seen = append(seen, tab.Title)
+		return tab.Title == "x"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs) != 1 || tabs[0].WindowIndex != 2 || tabs[0].Index != 1 {
+		t.Errorf("bad match. Expected=2x1, Got=%v", tabs)
+	}
+	if s := strings.Join(seen, " "); s != "a b c d e x y" {
+		t.Errorf("bad call order. Expected=%q, Got=%q", "a b c d e x y", s)
+	}
+	if s := layout(t); s != "a *b c d e|*x y" {
+		t.Errorf("tabs closed: %q", s)
+	}
+}
+
+// closeHookBackend calls a function after the first tab is closed.
+type closeHookBackend struct {
+	*FakeBackend
+	after func()
+}
+
+func (b *closeHookBackend) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	err := b.FakeBackend.Close(ctx, what, win, tab)
+	if b.after != nil {
+		b.after()
+		b.after = nil
+	}
+	return err
+}
+
+// countBackend counts calls to Windows.
+type countBackend struct {
+	*FakeBackend
+	n int
+}
+
+func (b *countBackend) Windows(ctx context.Context) ([]*Window, error) {
+	b.n++
+	return b.FakeBackend.Windows(ctx)
+}
+
+// TestCloseTabsWhereListings tests that Safari's windows are listed once
+// per window, not once per tab.
+func TestCloseTabsWhereListings(t *testing.T) {
+	fb, restore := newTestBackend()
+	defer restore()
+	cb := &countBackend{FakeBackend: fb}
+	SetBackend(cb)
+
+	closed, err := CloseTabsWhere(func(tab *Tab) bool { return tab.Title != "b" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 6 {
+		t.Errorf("bad no. of closed tabs. Expected=6, Got=%d", len(closed))
+	}
+	if cb.n != 2 {
+		t.Errorf("bad no. of listings. Expected=2, Got=%d", cb.n)
+	}
+}
+
+// TestCloseTabsWhereChanged tests that CloseTabsWhere closes the right tabs
+// if the windows change while it's closing them.
+func TestCloseTabsWhereChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(fb *FakeBackend)
+		closed string
+		x      string
+	}{
+		{"window raised", func(fb *FakeBackend) {
+			fb.Wins = []*FakeWindow{fb.Wins[1], fb.Wins[0]}
+		}, "a d y", "*x|*b c e"},
+		{"tab opened", func(fb *FakeBackend) {
+			fb.Wins[0].Tabs = append(fakeTabs("n"), fb.Wins[0].Tabs...)
+			fb.Wins[0].Current = 3
+		}, "a d y", "n *b c e|*x"},
+		{"tab closed", func(fb *FakeBackend) {
+			fb.Wins[0].Tabs = fb.Wins[0].Tabs[1:]
+			fb.Wins[0].Current = 1
+		}, "d y", "*b c e|*x"},
+	}
+
+	for _, td := range tests {
+		fb, restore := newTestBackend()
+		SetBackend(&closeHookBackend{fb, func() { td.change(fb) }})
+
+		closed, err := CloseTabsWhere(func(tab *Tab) bool {
+			return tab.Title == "a" || tab.Title == "d" || tab.Title == "y"
+		})
+		if err != nil {
+			t.Errorf("%s: %v", td.name, err)
+			restore()
+			continue
+		}
+		var titles []string
+		for _, tab := range closed {
+			titles = append(titles, tab.Title)
+		}
+		if s := strings.Join(titles, " "); s != td.closed {
+			t.Errorf("%s: bad closed tabs. Expected=%q, Got=%q", td.name, td.closed, s)
+		}
+		if s := layout(t); s != td.x {
+			t.Errorf("%s: bad layout. Expected=%q, Got=%q", td.name, td.x, s)
 		}
+		restore()
 	}
 }
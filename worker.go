@@ -0,0 +1,397 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-02
+//
+
+package safari
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/deanishe/go-safari/internal/errs"
+)
+
+// Worker is a Backend that runs the same scripts as OSAScript, but in a
+// single, long-lived osascript process, so it doesn't pay the cost of
+// starting osascript on every call.
+//
+// The worker process is started on first use and reads requests as
+// newline-delimited JSON from STDIN:
+//
+//	{"id": 1, "script": "tabs", "args": []}
+//
+// and writes one response per request to STDOUT:
+//
+//	{"id": 1, "output": "[...]", "error": ""}
+//
+// If the process has exited, it is restarted on the next call. A request
+// that is interrupted by the process dying fails with ErrWorkerDied and
+// is not retried, as the script may already have run. If a call's Context
+// is cancelled, the process is killed.
+//
+// A Worker is safe for concurrent use, but calls are run one at a time.
+// Call Stop to stop the worker process.
+type Worker struct {
+	// Command is the worker program and its arguments. If empty, osascript
+	// is run with the worker script.
+	Command []string
+
+	mu     sync.Mutex
+	proc   *workerProc
+	nextID int64
+}
+
+// NewWorker returns a Worker that runs scripts with osascript.
+func NewWorker() *Worker { return &Worker{} }
+
+// Windows implements Backend.
+func (w *Worker) Windows(ctx context.Context) ([]*Window, error) {
+	return jxaRunner(w.run).Windows(ctx)
+}
+
+// ActiveTab implements Backend.
+func (w *Worker) ActiveTab(ctx context.Context) (*Tab, error) {
+	return jxaRunner(w.run).ActiveTab(ctx)
+}
+
+// Activate implements Backend.
+func (w *Worker) Activate(ctx context.Context, win, tab int) error {
+	return jxaRunner(w.run).Activate(ctx, win, tab)
+}
+
+// Close implements Backend.
+func (w *Worker) Close(ctx context.Context, what CloseTarget, win, tab int) error {
+	return jxaRunner(w.run).Close(ctx, what, win, tab)
+}
+
+// RunJS implements Backend.
+func (w *Worker) RunJS(ctx context.Context, win, tab int, js string) error {
+	return jxaRunner(w.run).RunJS(ctx, win, tab, js)
+}
+
+// EvalJS implements Backend.
+func (w *Worker) EvalJS(ctx context.Context, win, tab int, js string) ([]byte, error) {
+	return jxaRunner(w.run).EvalJS(ctx, win, tab, js)
+}
+
+// Open implements Backend.
+func (w *Worker) Open(ctx context.Context, URL string, opts OpenOptions) (*Tab, error) {
+	return jxaRunner(w.run).Open(ctx, URL, opts)
+}
+
+// Navigate implements Backend.
+func (w *Worker) Navigate(ctx context.Context, action NavAction, win, tab int, URL string) error {
+	return jxaRunner(w.run).Navigate(ctx, action, win, tab, URL)
+}
+
+// Move implements Backend.
+func (w *Worker) Move(ctx context.Context, win, tab, toWin, toTab int) (*Tab, error) {
+	return jxaRunner(w.run).Move(ctx, win, tab, toWin, toTab)
+}
+
+// Reorder implements Backend.
+func (w *Worker) Reorder(ctx context.Context, win int, order []int) error {
+	return jxaRunner(w.run).Reorder(ctx, win, order)
+}
+
+// Stop kills the worker process, if it is running. The Worker may still be
+// used afterwards, in which case a new process is started.
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.proc != nil {
+		w.proc.kill()
+		w.proc = nil
+	}
+}
+
+// workerRequest is a request sent to the worker process.
+type workerRequest struct {
+	ID     int64    `json:"id"`
+	Script string   `json:"script"`
+	Args   []string `json:"args"`
+}
+
+// workerResponse is the worker process's response to a request.
+type workerResponse struct {
+	ID     int64  `json:"id"`
+	Output string `json:"output"`
+	Error  string `json:"error"`
+}
+
+// run implements jxaRunner. It sends a request to run script to the worker
+// process, starting the process if necessary.
+func (w *Worker) run(ctx context.Context, script string, argv ...string) ([]byte, error) {
+	name := scriptName(script)
+	if name == "" {
+		return nil, errors.New("script not loaded by worker")
+	}
+	if argv == nil {
+		argv = []string{}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w.nextID++
+	data, err := json.Marshal(workerRequest{w.nextID, name, argv})
+	if err != nil {
+		return nil, err
+	}
+	data = append(asciiJSON(data), '\n')
+
+	// A request that couldn't be written wasn't run, so it's safe to
+	// retry it with a new process.
+	var p *workerProc
+	for i := 0; i < 2; i++ {
+		if p, err = w.process(); err != nil {
+			return nil, err
+		}
+		if _, err = p.stdin.Write(data); err == nil {
+			break
+		}
+		p.kill()
+		w.proc = nil
+	}
+	if err != nil {
+		return nil, p.withStderr(fmt.Errorf("%w: %v", ErrWorkerDied, err))
+	}
+
+	type result struct {
+		resp *workerResponse
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := p.read()
+		ch <- result{resp, err}
+	}()
+
+	var r result
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		p.kill()
+		w.proc = nil
+		<-ch
+		return nil, ctx.Err()
+	}
+
+	if r.err != nil {
+		p.kill()
+		w.proc = nil
+		return nil, p.withStderr(r.err)
+	}
+	if r.resp.ID != w.nextID {
+		p.kill()
+		w.proc = nil
+		return nil, fmt.Errorf("worker answered request %d, expected %d", r.resp.ID, w.nextID)
+	}
+	if r.resp.Error != "" {
+		return nil, errs.OSAScript(errors.New(r.resp.Error))
+	}
+	return []byte(r.resp.Output), nil
+}
+
+// process returns the running worker process, starting a new one if
+// there isn't one or it has exited.
+func (w *Worker) process() (*workerProc, error) {
+	if w.proc != nil {
+		select {
+		case <-w.proc.done:
+			w.proc.kill()
+			w.proc = nil
+		default:
+			return w.proc, nil
+		}
+	}
+
+	p, err := startWorker(w.command())
+	if err != nil {
+		return nil, err
+	}
+	w.proc = p
+	return p, nil
+}
+
+// command returns the program and arguments that start the worker process.
+func (w *Worker) command() []string {
+	if len(w.Command) > 0 {
+		return w.Command
+	}
+	return []string{"/usr/bin/osascript", "-l", "JavaScript", "-e", workerScript()}
+}
+
+// Maximum number of bytes of a worker process's STDERR that are kept.
+const maxWorkerStderr = 4096
+
+// workerProc is a running worker process.
+type workerProc struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	pipe   *os.File      // read end of STDOUT
+	stderr *tailBuffer   // end of STDERR, e.g. compilation errors
+	done   chan struct{} // closed when process exits
+}
+
+// startWorker starts a worker process with command argv.
+func startWorker(argv []string) (*workerProc, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Use our own pipe, not StdoutPipe, so reads don't race with Wait.
+	r, wr, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = wr
+	stderr := &tailBuffer{max: maxWorkerStderr}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		wr.Close()
+		return nil, errs.OSAScript(err)
+	}
+	wr.Close()
+
+	p := &workerProc{cmd, stdin, bufio.NewReader(r), r, stderr, make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// read reads a response from the worker process.
+func (p *workerProc) read() (*workerResponse, error) {
+	line, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrWorkerDied
+		}
+		return nil, fmt.Errorf("%w: %v", ErrWorkerDied, err)
+	}
+	resp := &workerResponse{}
+	if err := json.Unmarshal(line, resp); err != nil {
+		return nil, fmt.Errorf("invalid response from worker: %w", err)
+	}
+	return resp, nil
+}
+
+// kill kills the worker process, waits for it to exit and closes its pipes.
+// It is safe to call kill on a process that has already exited.
+func (p *workerProc) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	<-p.done
+	p.pipe.Close()
+}
+
+// withStderr adds the process's STDERR, if any, to err. Call it after kill,
+// so all of STDERR has been read.
+func (p *workerProc) withStderr(err error) error {
+	if s := strings.TrimSpace(p.stderr.String()); s != "" {
+		return fmt.Errorf("%w (stderr: %s)", err, s)
+	}
+	return err
+}
+
+// tailBuffer is an io.Writer that keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write implements io.Writer.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if n := len(b.buf) - b.max; n > 0 {
+		b.buf = append(b.buf[:0], b.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept.
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// scriptName returns the name the worker knows script by, or an empty
+// string if the worker doesn't load script.
+func scriptName(script string) string {
+	for name, s := range jxaScripts {
+		if s == script {
+			return name
+		}
+	}
+	return ""
+}
+
+// workerScript returns the JXA program run by the worker process.
+func workerScript() string {
+	var names []string
+	for name := range jxaScripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := jsWorker
+	for _, name := range names {
+		s += fmt.Sprintf("scripts[%s] = load(%s)\n", quoteJS(name), quoteJS(jxaScripts[name]))
+	}
+	return s
+}
+
+// quoteJS returns s as a JavaScript string literal.
+func quoteJS(s string) string {
+	data, _ := json.Marshal(s)
+	return string(asciiJSON(data))
+}
+
+// asciiJSON escapes all non-ASCII characters in JSON data, so the worker
+// can't receive a partial UTF-8 sequence.
+func asciiJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r < utf8.RuneSelf {
+			buf.WriteByte(data[0])
+		} else if r > 0xffff {
+			r -= 0x10000
+			fmt.Fprintf(&buf, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		} else {
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		}
+		data = data[size:]
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+//
+// MIT Licence. See http://opensource.org/licenses/MIT
+//
+// Created on 2019-03-02
+//
+
+package safari
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// If set, the test binary acts as a stub worker process.
+const stubWorkerEnv = "GO_SAFARI_STUB_WORKER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stubWorkerEnv) != "" {
+		stubWorker()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// stubWorker speaks the worker protocol on STDIN/STDOUT. Its tab's title
+// is its PID. Activating window 99 crashes it with a message on STDERR,
+// activating window 5 fails, and running the JavaScript "sleep" hangs.
+func stubWorker() {
+	var (
+		in  = bufio.NewScanner(os.Stdin)
+		out = json.NewEncoder(os.Stdout)
+		tab = &Tab{Index: 1, WindowIndex: 1, Title: fmt.Sprintf("%d", os.Getpid()), URL: "https://a.example.com/", Active: true}
+	)
+	for in.Scan() {
+		req := workerRequest{}
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		resp := workerResponse{ID: req.ID}
+		switch req.Script {
+		case "tabs":
+			data, _ := json.Marshal([]*Window{{Index: 1, ActiveTab: 1, Tabs: []*Tab{tab}}})
+			resp.Output = string(data)
+		case "current-tab":
+			data, _ := json.Marshal(tab)
+			resp.Output = string(data)
+		case "activate":
+			switch req.Args[0] {
+			case "99":
+				fmt.Fprintln(os.Stderr, "stub worker crashed")
+				os.Exit(1)
+			case "5":
+				resp.Error = "Invalid window: 5"
+			}
+		case "run-js":
+			if req.Args[2] == "sleep" {
+				time.Sleep(time.Minute)
+			}
+			// Echo script, so the test can check non-ASCII arguments
+			resp.Error = "ran: " + req.Args[2]
+		default:
+			resp.Error = "Unknown script: " + req.Script
+		}
+		out.Encode(resp)
+	}
+}
+
+// testWorker returns a Worker that runs the stub worker. Call the returned
+// function to stop it.
+func testWorker(t *testing.T) (*Worker, func()) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(stubWorkerEnv, "1")
+	w := &Worker{Command: []string{exe}}
+	return w, func() {
+		w.Stop()
+		os.Unsetenv(stubWorkerEnv)
+	}
+}
+
+// workerPID returns the PID of w's worker process, as reported by the stub.
+func workerPID(t *testing.T, w *Worker) string {
+	wins, err := w.Windows(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wins) != 1 || len(wins[0].Tabs) != 1 {
+		t.Fatalf("bad windows: %#v", wins)
+	}
+	return wins[0].Tabs[0].Title
+}
+
+func TestWorker(t *testing.T) {
+	w, cleanup := testWorker(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// Process is reused
+	pid := workerPID(t, w)
+	if s := workerPID(t, w); s != pid {
+		t.Errorf("worker restarted. Expected=%s, Got=%s", pid, s)
+	}
+
+	tab, err := w.ActiveTab(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab.Title != pid || tab.URL != "https://a.example.com/" {
+		t.Errorf("bad active tab: %#v", tab)
+	}
+
+	if err := w.Activate(ctx, 1, 1); err != nil {
+		t.Errorf("activate: %v", err)
+	}
+
+	// Script errors are mapped onto package errors
+	if err := w.Activate(ctx, 5, 0); !errors.Is(err, ErrNoSuchWindow) {
+		t.Errorf("bad window: Expected=ErrNoSuchWindow, Got=%v", err)
+	}
+
+	// Arguments survive the trip
+	js := `alert("Grüße 👋")`
+	err = w.RunJS(ctx, 1, 1, js)
+	if err == nil || !strings.HasSuffix(err.Error(), js) {
+		t.Errorf("bad arguments. Expected=%q, Got=%v", "ran: "+js, err)
+	}
+
+	if s := workerPID(t, w); s != pid {
+		t.Errorf("worker restarted after errors. Expected=%s, Got=%s", pid, s)
+	}
+}
+
+func TestWorkerRestart(t *testing.T) {
+	w, cleanup := testWorker(t)
+	defer cleanup()
+
+	// Crash during request
+	pid := workerPID(t, w)
+	err := w.Activate(context.Background(), 99, 0)
+	if !errors.Is(err, ErrWorkerDied) {
+		t.Errorf("crash: Expected=ErrWorkerDied, Got=%v", err)
+	} else if !strings.Contains(err.Error(), "stub worker crashed") {
+		t.Errorf("crash: STDERR not in error: %v", err)
+	}
+	pid2 := workerPID(t, w)
+	if pid2 == pid {
+		t.Error("worker not restarted after crash")
+	}
+
+	// Stopped between requests
+	w.Stop()
+	if s := workerPID(t, w); s == pid2 {
+		t.Error("worker not restarted after Stop")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 5}
+	fmt.Fprint(b, "abc")
+	fmt.Fprint(b, "defg")
+	if s := b.String(); s != "cdefg" {
+		t.Errorf("Expected=%q, Got=%q", "cdefg", s)
+	}
+}
+
+func TestWorkerContext(t *testing.T) {
+	w, cleanup := testWorker(t)
+	defer cleanup()
+
+	pid := workerPID(t, w)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := w.RunJS(ctx, 1, 1, "sleep"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout: Expected=DeadlineExceeded, Got=%v", err)
+	}
+	if s := workerPID(t, w); s == pid {
+		t.Error("hung worker not killed")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.Windows(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: Expected=Canceled, Got=%v", err)
+	}
+}
+
+func TestWorkerScript(t *testing.T) {
+	s := workerScript()
+	for name := range jxaScripts {
+		if !strings.Contains(s, fmt.Sprintf("scripts[%q] = load(", name)) {
+			t.Errorf("script %q not loaded", name)
+		}
+	}
+	for i, r := range s {
+		if r > 127 {
+			t.Errorf("non-ASCII character %q at %d", r, i)
+			break
+		}
+	}
+	if scriptName(jsGetTabs) != "tabs" {
+		t.Errorf("bad script name. Expected=tabs, Got=%q", scriptName(jsGetTabs))
+	}
+	if _, err := (&Worker{}).run(context.Background(), "not a script"); err == nil {
+		t.Error("unknown script accepted")
+	}
+}
+
+func TestASCIIJSON(t *testing.T) {
+	tests := []string{"", "plain", "Grüße", "日本語", "emoji 👋", "\"quoted\"\n"}
+	for _, s := range tests {
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = asciiJSON(data)
+		for _, b := range data {
+			if b > 127 {
+				t.Errorf("%q: non-ASCII output %q", s, data)
+				break
+			}
+		}
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if v != s {
+			t.Errorf("bad round trip. Expected=%q, Got=%q", s, v)
+		}
+	}
+}